@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	envPrefix     = "TTVLDR_"
+	envConfigFile = envPrefix + "CONFIG"
+)
+
+// configPath returns path to the config file: TTVLDR_CONFIG or ttvldr/config in user config directory
+func configPath() string {
+	if p := os.Getenv(envConfigFile); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ttvldr", "config")
+}
+
+// readConfig parses config file with "option = value" lines. Lines starting with # are comments.
+// Missing file is not an error
+func readConfig(file string) (map[string]string, error) {
+	conf := make(map[string]string)
+	if file == "" {
+		return conf, nil
+	}
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return conf, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("readConfig: cannot open config file %s. %s", file, err.Error())
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("readConfig: line %d of %s is not in 'option = value' format", n, file)
+		}
+		conf[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	if err = sc.Err(); err != nil {
+		return nil, fmt.Errorf("readConfig: cannot read config file %s. %s", file, err.Error())
+	}
+	return conf, nil
+}
+
+// envName returns environment variable for the given option, e.g. TTVLDR_MUX_SUBS for mux-subs
+func envName(option string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(option, "-", "_", -1))
+}
+
+// applyDefaults sets flags from the config and then from environment variables,
+// so command line arguments parsed later override both
+func applyDefaults(fs *flag.FlagSet, conf map[string]string) error {
+	for name := range conf {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("applyDefaults: unknown option %s in config file", name)
+		}
+	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v, ok := conf[f.Name]
+		if ev, eok := os.LookupEnv(envName(f.Name)); eok {
+			v, ok = ev, true
+		}
+		if !ok || err != nil {
+			return
+		}
+		if serr := fs.Set(f.Name, v); serr != nil {
+			err = fmt.Errorf("applyDefaults: wrong value %q for option %s. %s", v, f.Name, serr.Error())
+		}
+	})
+	return err
+}
+
+// flagPresence is a placeholder value that only records whether a flag is given
+type flagPresence bool
+
+func (flagPresence) String() string { return "" }
+
+func (flagPresence) Set(string) error { return nil }
+
+// IsBoolFlag reports whether the flag takes no value, it's true for placeholders of bool flags
+func (p flagPresence) IsBoolFlag() bool { return bool(p) }
+
+// commandLineFlags returns names of flags given in args. Values are not applied to fs
+func commandLineFlags(fs *flag.FlagSet, args []string) map[string]bool {
+	scratch := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	scratch.SetOutput(ioutil.Discard)
+	fs.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		scratch.Var(flagPresence(ok && b.IsBoolFlag()), f.Name, f.Usage)
+	})
+	scratch.Parse(args)
+	set := make(map[string]bool)
+	scratch.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// optionValue returns the value of the option with the precedence used on start:
+// command line, then environment variable, then config file, then the default
+func optionValue(fs *flag.FlagSet, name string, cli map[string]bool, conf map[string]string) string {
+	f := fs.Lookup(name)
+	if cli[name] {
+		return f.Value.String()
+	}
+	if v, ok := os.LookupEnv(envName(name)); ok {
+		return v
+	}
+	if v, ok := conf[name]; ok {
+		return v
+	}
+	return f.DefValue
+}
+
+// reloadValue returns the value of the option on reload. The config file is the only source that can change
+// while the program is running, so its value takes precedence over the one chosen on start
+func reloadValue(fs *flag.FlagSet, name string, cli map[string]bool, conf map[string]string) string {
+	if v, ok := conf[name]; ok {
+		return v
+	}
+	return optionValue(fs, name, cli, nil)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ttvldr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config")
+	data := "# comment\n\noauth = abc=def\n  quality=720p60  \n"
+	if err = ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := readConfig(file)
+	if err != nil {
+		t.Fatalf("readConfig: test failed. got an error: %s", err.Error())
+	}
+	if len(conf) != 2 || conf["oauth"] != "abc=def" || conf["quality"] != "720p60" {
+		t.Errorf("readConfig: test failed. got: %v", conf)
+	}
+
+	conf, err = readConfig(filepath.Join(dir, "missing"))
+	if err != nil || len(conf) != 0 {
+		t.Errorf("readConfig: test failed. got: %v. err: %v", conf, err)
+	}
+
+	if err = ioutil.WriteFile(file, []byte("oauth abc"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readConfig(file); err == nil {
+		t.Errorf("readConfig: test failed. want an error for malformed line")
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	oauth := fs.String("oauth", "", "")
+	quality := fs.String("quality", "chunked", "")
+	muxSubs := fs.Bool("mux-subs", false, "")
+
+	os.Setenv(envName("quality"), "480p30")
+	defer os.Unsetenv(envName("quality"))
+	err := applyDefaults(fs, map[string]string{"oauth": "abc", "quality": "720p60", "mux-subs": "true"})
+	if err != nil {
+		t.Fatalf("applyDefaults: test failed. got an error: %s", err.Error())
+	}
+	if *oauth != "abc" || *quality != "480p30" || !*muxSubs {
+		t.Errorf("applyDefaults: test failed. got: oauth=%s quality=%s mux-subs=%v", *oauth, *quality, *muxSubs)
+	}
+	if err = fs.Parse([]string{"-quality", "160p30"}); err != nil || *quality != "160p30" {
+		t.Errorf("applyDefaults: command line must override defaults. got: %s. err: %v", *quality, err)
+	}
+
+	if err = applyDefaults(fs, map[string]string{"foo": "bar"}); err == nil {
+		t.Errorf("applyDefaults: test failed. want an error for unknown option")
+	}
+	if err = applyDefaults(fs, map[string]string{"mux-subs": "maybe"}); err == nil {
+		t.Errorf("applyDefaults: test failed. want an error for wrong value")
+	}
+}
+
+func TestOptionValue(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("limit-rate", "0", "")
+	fs.String("limit-schedule", "", "")
+	fs.String("quality", "best", "")
+	fs.Bool("chat", false, "")
+	args := []string{"-chat", "-limit-rate", "1M", "twitch.tv/videos/123456789", "-quality", "worst"}
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	cli := commandLineFlags(fs, args)
+	if len(cli) != 2 || !cli["chat"] || !cli["limit-rate"] {
+		t.Errorf("commandLineFlags: test failed. got: %v", cli)
+	}
+
+	os.Setenv(envName("limit-schedule"), "09:00-18:00=1M")
+	defer os.Unsetenv(envName("limit-schedule"))
+	conf := map[string]string{"limit-rate": "2M", "limit-schedule": "22:00-06:00=0"}
+	cases := []struct {
+		name string
+		conf map[string]string
+		want string
+	}{
+		{"limit-rate", conf, "1M"},
+		{"limit-schedule", conf, "09:00-18:00=1M"},
+		{"quality", map[string]string{"quality": "720p"}, "720p"},
+		{"quality", conf, "best"},
+	}
+	for _, c := range cases {
+		if got := optionValue(fs, c.name, cli, c.conf); got != c.want {
+			t.Errorf("optionValue: test failed. option: %s. got: %s. want: %s", c.name, got, c.want)
+		}
+	}
+
+	// limit-rate is given on the command line and changed in the config file for reload
+	reloads := []struct {
+		name string
+		conf map[string]string
+		want string
+	}{
+		{"limit-rate", conf, "2M"},
+		{"limit-rate", map[string]string{}, "1M"},
+		{"limit-schedule", conf, "22:00-06:00=0"},
+		{"limit-schedule", map[string]string{}, "09:00-18:00=1M"},
+	}
+	for _, c := range reloads {
+		if got := reloadValue(fs, c.name, cli, c.conf); got != c.want {
+			t.Errorf("reloadValue: test failed. option: %s. got: %s. want: %s", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package downloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const chatExtension = ".jsonl"
+
+// Chat is a flag that enables downloading of chat replay alongside the VOD
+var Chat bool
+
+// chatMessage is a single line of a chat log stored on disk
+type chatMessage struct {
+	Offset    float64        `json:"offset"`
+	CreatedAt time.Time      `json:"created_at"`
+	User      chatUser       `json:"user"`
+	Badges    []chatBadge    `json:"badges,omitempty"`
+	Emotes    []chatEmote    `json:"emotes,omitempty"`
+	Fragments []chatFragment `json:"fragments,omitempty"`
+	Body      string         `json:"body"`
+	IsAction  bool           `json:"is_action,omitempty"`
+}
+
+type chatUser struct {
+	ID          string `json:"id"`
+	Login       string `json:"login"`
+	DisplayName string `json:"display_name"`
+	Color       string `json:"color,omitempty"`
+}
+
+type chatBadge struct {
+	ID      string `json:"id"`
+	Version string `json:"version"`
+}
+
+type chatEmote struct {
+	ID    string `json:"id"`
+	Begin int    `json:"begin"`
+	End   int    `json:"end"`
+}
+
+type chatFragment struct {
+	Text    string `json:"text"`
+	EmoteID string `json:"emote_id,omitempty"`
+}
+
+// chatQuery pages through comments of a VOD from the offset in seconds or after the cursor
+const chatQuery = `query VideoCommentsByOffsetOrCursor($videoID: ID!, $contentOffsetSeconds: Int, $cursor: Cursor) {
+	video(id: $videoID) {
+		comments(contentOffsetSeconds: $contentOffsetSeconds, after: $cursor) {
+			edges {
+				cursor
+				node {
+					contentOffsetSeconds
+					createdAt
+					commenter {
+						id
+						login
+						displayName
+					}
+					message {
+						userColor
+						fragments {
+							text
+							emote {
+								emoteID
+								from
+							}
+						}
+						userBadges {
+							setID
+							version
+						}
+					}
+				}
+			}
+			pageInfo {
+				hasNextPage
+			}
+		}
+	}
+}`
+
+// chatActionPrefix starts /me messages, IRC CTCP ACTION
+const chatActionPrefix = "\x01ACTION "
+
+// chatPage is a single page of comments as returned by VideoCommentsByOffsetOrCursor query
+type chatPage struct {
+	Edges []struct {
+		Cursor string `json:"cursor"`
+		Node   struct {
+			ContentOffsetSeconds float64   `json:"contentOffsetSeconds"`
+			CreatedAt            time.Time `json:"createdAt"`
+			// Commenter is null for deleted users
+			Commenter *struct {
+				ID          string `json:"id"`
+				Login       string `json:"login"`
+				DisplayName string `json:"displayName"`
+			} `json:"commenter"`
+			Message struct {
+				UserColor string `json:"userColor"`
+				Fragments []struct {
+					Text  string `json:"text"`
+					Emote *struct {
+						EmoteID string `json:"emoteID"`
+						From    int    `json:"from"`
+					} `json:"emote"`
+				} `json:"fragments"`
+				UserBadges []struct {
+					SetID   string `json:"setID"`
+					Version string `json:"version"`
+				} `json:"userBadges"`
+			} `json:"message"`
+		} `json:"node"`
+	} `json:"edges"`
+	PageInfo struct {
+		HasNextPage bool `json:"hasNextPage"`
+	} `json:"pageInfo"`
+}
+
+// next returns the cursor of the next page, empty on the last page
+func (p *chatPage) next() string {
+	if !p.PageInfo.HasNextPage || len(p.Edges) == 0 {
+		return ""
+	}
+	return p.Edges[len(p.Edges)-1].Cursor
+}
+
+func (p *chatPage) messages() []chatMessage {
+	m := make([]chatMessage, 0, len(p.Edges))
+	for _, e := range p.Edges {
+		c := e.Node
+		msg := chatMessage{
+			Offset:    c.ContentOffsetSeconds,
+			CreatedAt: c.CreatedAt,
+			User:      chatUser{Color: c.Message.UserColor},
+		}
+		if c.Commenter != nil {
+			msg.User.ID, msg.User.Login, msg.User.DisplayName = c.Commenter.ID, c.Commenter.Login, c.Commenter.DisplayName
+		}
+		for _, b := range c.Message.UserBadges {
+			msg.Badges = append(msg.Badges, chatBadge{ID: b.SetID, Version: b.Version})
+		}
+		body := ""
+		for i, f := range c.Message.Fragments {
+			text := f.Text
+			if i == 0 && strings.HasPrefix(text, chatActionPrefix) {
+				text, msg.IsAction = strings.TrimSuffix(text[len(chatActionPrefix):], "\x01"), true
+			}
+			fr := chatFragment{Text: text}
+			if f.Emote != nil {
+				fr.EmoteID = f.Emote.EmoteID
+				// emote positions are in characters, end is inclusive
+				msg.Emotes = append(msg.Emotes, chatEmote{ID: f.Emote.EmoteID, Begin: f.Emote.From, End: f.Emote.From + utf8.RuneCountInString(text) - 1})
+			}
+			msg.Fragments = append(msg.Fragments, fr)
+			body += text
+		}
+		msg.Body = body
+		m = append(m, msg)
+	}
+	return m
+}
+
+func getChatPage(vodID string, offset int, cursor string) (*chatPage, error) {
+	vars := map[string]interface{}{"videoID": vodID}
+	if cursor != "" {
+		vars["cursor"] = cursor
+	} else {
+		vars["contentOffsetSeconds"] = offset
+	}
+	resp, err := postGQL("VideoCommentsByOffsetOrCursor", chatQuery, vars)
+	if err != nil {
+		return nil, fmt.Errorf("getChatPage: cannot retrieve comments. %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getChatPage: server responded with %d code", resp.StatusCode)
+	}
+
+	var data struct {
+		Data struct {
+			Video *struct {
+				Comments *chatPage `json:"comments"`
+			} `json:"video"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("getChatPage: cannot decode data. %s", err.Error())
+	}
+	switch {
+	case len(data.Errors) > 0:
+		return nil, fmt.Errorf("getChatPage: query failed. %s", data.Errors[0].Message)
+	case data.Data.Video == nil:
+		return nil, fmt.Errorf("getChatPage: no VOD with ID %s", vodID)
+	case data.Data.Video.Comments == nil:
+		return nil, fmt.Errorf("getChatPage: chat replay of VOD %s is unavailable", vodID)
+	}
+	return data.Data.Video.Comments, nil
+}
+
+// downloadChat pages through the comment history of the VOD between start and end
+// and writes every message as a JSON line into file. End "-1" means the whole VOD
+func downloadChat(vodID, start, end, file string) (count int, err error) {
+	ss, es := 0, -1
+	if end != "-1" {
+		ss, es = convertTimeToSeconds(start), convertTimeToSeconds(end)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return 0, fmt.Errorf("downloadChat: cannot create file %s. %s", file, err.Error())
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	cursor := ""
+LOOP:
+	for {
+		page, err := getChatPage(vodID, ss, cursor)
+		if err != nil {
+			return count, err
+		}
+		for _, m := range page.messages() {
+			if m.Offset < float64(ss) {
+				continue
+			}
+			if es != -1 && m.Offset > float64(es) {
+				break LOOP
+			}
+			if err = enc.Encode(m); err != nil {
+				return count, fmt.Errorf("downloadChat: cannot encode message. %s", err.Error())
+			}
+			count++
+		}
+		if cursor = page.next(); cursor == "" {
+			break
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return count, fmt.Errorf("downloadChat: cannot write file %s. %s", file, err.Error())
+	}
+	return count, nil
+}
+
+// chatJob downloads chat replay of the VOD between start and end once, even if several downloads
+// of the VOD share it. Downloads of the same range may start at different positions, so subtitles
+// are rendered for every one of them
+type chatJob struct {
+	vodID, start, end string
+
+	once sync.Once
+	done chan struct{}
+	// file is the chat log, empty if it was not saved
+	file string
+
+	mu sync.Mutex
+	// subs are rendered subtitles by position of the first downloaded segment
+	subs map[float64]string
+}
+
+func newChatJob(vodID, start, end string) *chatJob {
+	return &chatJob{vodID: vodID, start: start, end: end, done: make(chan struct{}), subs: make(map[float64]string)}
+}
+
+// run starts downloading in background. Only the first call has effect
+func (j *chatJob) run(log *slog.Logger) {
+	j.once.Do(func() {
+		go func() {
+			defer close(j.done)
+			chatStartT := time.Now()
+			file := freeFileName(filepath.Join(OutputDir, j.vodID+"_chat"), chatExtension)
+			count, err := downloadChat(j.vodID, j.start, j.end, file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\nCould not download chat replay\n")
+				log.Warn("chat replay download failed", "err", err)
+				return
+			}
+			log.Debug("chat replay saved", "messages", count, "file", file)
+			if TimeF {
+				fmt.Printf("\nChat downloading time: %f seconds\n", time.Since(chatStartT).Seconds())
+			}
+			fmt.Printf("\nChat replay was saved in %s", file)
+			j.file = file
+		}()
+	})
+}
+
+// wait waits for the chat replay and returns subtitles timed from videoStart, the position
+// of the first downloaded segment. It's empty if there are no subtitles
+func (j *chatJob) wait(videoStart float64, log *slog.Logger) string {
+	<-j.done
+	if j.file == "" || Subtitles == "" {
+		return ""
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if subs, ok := j.subs[videoStart]; ok {
+		return subs
+	}
+	file := freeFileName(strings.TrimSuffix(j.file, chatExtension), "."+Subtitles)
+	subs, err := renderChat(j.file, file, Subtitles, videoStart)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nCould not render chat replay to subtitles\n")
+		log.Warn("chat replay rendering failed", "err", err)
+	} else {
+		fmt.Printf("\nChat subtitles were saved in %s", subs)
+	}
+	j.subs[videoStart] = subs
+	return subs
+}
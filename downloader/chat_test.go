@@ -0,0 +1,101 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChatPageMessages(t *testing.T) {
+	data := `{"edges":[{"cursor":"abc","node":{"contentOffsetSeconds":12.5,"createdAt":"2018-09-13T21:48:01.123Z",
+	"commenter":{"id":"42","login":"foo","displayName":"Foo"},
+	"message":{"userColor":"#FF0000",
+	"fragments":[{"text":"hi ","emote":null},{"text":"Kappa","emote":{"emoteID":"25","from":3}}],
+	"userBadges":[{"setID":"subscriber","version":"12"}]}}}],"pageInfo":{"hasNextPage":true}}`
+	var page chatPage
+	if err := json.Unmarshal([]byte(data), &page); err != nil {
+		t.Fatalf("chatPage: cannot unmarshal test data. %s", err.Error())
+	}
+	if page.next() != "abc" {
+		t.Errorf("chatPage: test failed. got cursor: %s. want: %s", page.next(), "abc")
+	}
+	msgs := page.messages()
+	if len(msgs) != 1 {
+		t.Fatalf("chatPage.messages: test failed. got %d messages. want: 1", len(msgs))
+	}
+	m := msgs[0]
+	if m.Offset != 12.5 || m.Body != "hi Kappa" || m.User.Login != "foo" || m.User.DisplayName != "Foo" || m.User.Color != "#FF0000" {
+		t.Errorf("chatPage.messages: test failed. got: %+v", m)
+	}
+	if len(m.Badges) != 1 || m.Badges[0] != (chatBadge{ID: "subscriber", Version: "12"}) {
+		t.Errorf("chatPage.messages: test failed. got badges: %+v", m.Badges)
+	}
+	if len(m.Emotes) != 1 || m.Emotes[0] != (chatEmote{ID: "25", Begin: 3, End: 7}) {
+		t.Errorf("chatPage.messages: test failed. got emotes: %+v", m.Emotes)
+	}
+	if len(m.Fragments) != 2 || m.Fragments[0].EmoteID != "" || m.Fragments[1].EmoteID != "25" {
+		t.Errorf("chatPage.messages: test failed. got fragments: %+v", m.Fragments)
+	}
+}
+
+func TestChatPageAction(t *testing.T) {
+	data := `{"edges":[{"cursor":"abc","node":{"contentOffsetSeconds":1,"commenter":null,
+	"message":{"fragments":[{"text":"\u0001ACTION waves\u0001","emote":null}]}}}],"pageInfo":{"hasNextPage":false}}`
+	var page chatPage
+	if err := json.Unmarshal([]byte(data), &page); err != nil {
+		t.Fatalf("chatPage: cannot unmarshal test data. %s", err.Error())
+	}
+	if page.next() != "" {
+		t.Errorf("chatPage: test failed. got cursor on the last page: %s", page.next())
+	}
+	m := page.messages()[0]
+	if m.Body != "waves" || !m.IsAction || m.User.Login != "" {
+		t.Errorf("chatPage.messages: test failed. got: %+v", m)
+	}
+}
+
+func TestChatJobSubtitles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ttvldr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(s string) { Subtitles = s }(Subtitles)
+	Subtitles = subtitlesSRT
+
+	file := filepath.Join(dir, "123_chat"+chatExtension)
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := json.NewEncoder(f)
+	for _, m := range testChat {
+		enc.Encode(m)
+	}
+	f.Close()
+	// chat log is downloaded once for both qualities, which start at different positions
+	j := newChatJob("123", "0", "-1")
+	j.file = file
+	close(j.done)
+	log := logger.With("job", "test")
+
+	first := j.wait(10, log)
+	second := j.wait(11, log)
+	if first == "" || second == "" || first == second {
+		t.Fatalf("chatJob: test failed. got subtitles: %q and %q. want two different files", first, second)
+	}
+	if again := j.wait(10, log); again != first {
+		t.Errorf("chatJob: test failed. got: %q. want subtitles rendered once: %q", again, first)
+	}
+	for name, offset := range map[string]float64{first: 10, second: 11} {
+		got, _ := ioutil.ReadFile(name)
+		want := bytes.NewBufferString("")
+		writeSRT(want, testChat, offset)
+		if string(got) != want.String() {
+			t.Errorf("chatJob: test failed for %s. got: %q. want: %q", name, got, want.String())
+		}
+	}
+}
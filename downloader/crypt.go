@@ -0,0 +1,208 @@
+package downloader
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	hlsKey           = "#EXT-X-KEY:"
+	keyMethodNone    = "NONE"
+	keyMethodAES128  = "AES-128"
+	cbcReadChunkSize = 32 * 1024
+)
+
+// segmentKey describes how a segment is encrypted
+type segmentKey struct {
+	method string
+	uri    string
+	iv     []byte
+}
+
+// keyEntry is a key that is fetched once. done is closed when key or err is set
+type keyEntry struct {
+	done chan struct{}
+	key  []byte
+	err  error
+}
+
+var keyCache = struct {
+	sync.Mutex
+	keys map[string]*keyEntry
+}{keys: make(map[string]*keyEntry)}
+
+// parseKey parses attributes of #EXT-X-KEY tag. Nil key means segments are not encrypted
+func parseKey(attrs map[string]string, resolve func(string) (string, error)) (*segmentKey, error) {
+	method := attrs["METHOD"]
+	if method == "" || method == keyMethodNone {
+		return nil, nil
+	}
+	if attrs["URI"] == "" {
+		return nil, fmt.Errorf("parseKey: no URI for %s key", method)
+	}
+	uri, err := resolve(attrs["URI"])
+	if err != nil {
+		return nil, fmt.Errorf("parseKey: %s", err.Error())
+	}
+	k := &segmentKey{method: method, uri: uri}
+	if iv := attrs["IV"]; iv != "" {
+		iv = strings.TrimPrefix(strings.TrimPrefix(iv, "0x"), "0X")
+		k.iv, err = hex.DecodeString(iv)
+		if err != nil || len(k.iv) != aes.BlockSize {
+			return nil, fmt.Errorf("parseKey: wrong IV %s", attrs["IV"])
+		}
+	}
+	return k, nil
+}
+
+// fetchKey downloads a key once and keeps it for other segments. Segments of the same key wait
+// for a single request, other keys are fetched independently. Failed requests are not cached
+func fetchKey(uri string) ([]byte, error) {
+	keyCache.Lock()
+	e, ok := keyCache.keys[uri]
+	if !ok {
+		e = &keyEntry{done: make(chan struct{})}
+		keyCache.keys[uri] = e
+	}
+	keyCache.Unlock()
+	if ok {
+		<-e.done
+		return e.key, e.err
+	}
+	e.key, e.err = requestKey(uri)
+	if e.err != nil {
+		keyCache.Lock()
+		delete(keyCache.keys, uri)
+		keyCache.Unlock()
+	}
+	close(e.done)
+	return e.key, e.err
+}
+
+func requestKey(uri string) ([]byte, error) {
+	resp, err := playlistGet(uri)
+	if err != nil {
+		return nil, fmt.Errorf("fetchKey: cannot retrieve key. %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetchKey: server responded with %d code", resp.StatusCode)
+	}
+	k, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("fetchKey: cannot read key. %s", err.Error())
+	}
+	if len(k) != aes.BlockSize {
+		return nil, fmt.Errorf("fetchKey: key must be %d bytes long, got %d", aes.BlockSize, len(k))
+	}
+	return k, nil
+}
+
+// decryptSegment wraps encrypted segment body with a decrypting reader
+func decryptSegment(r io.Reader, seg segment) (io.Reader, error) {
+	if seg.key == nil {
+		return r, nil
+	}
+	if seg.key.method != keyMethodAES128 {
+		return nil, fmt.Errorf("decryptSegment: encryption method %s is not supported", seg.key.method)
+	}
+	k, err := fetchKey(seg.key.uri)
+	if err != nil {
+		return nil, err
+	}
+	return newCBCReader(r, k, segmentIV(seg))
+}
+
+// segmentIV returns IV of the key or, if it's absent, media sequence number of the segment
+func segmentIV(seg segment) []byte {
+	if seg.key.iv != nil {
+		return seg.key.iv
+	}
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], uint64(seg.sequence))
+	return iv
+}
+
+// cbcReader decrypts AES-128-CBC stream and removes PKCS#7 padding at the end
+type cbcReader struct {
+	r    io.Reader
+	mode cipher.BlockMode
+	in   []byte
+	out  []byte
+	err  error
+}
+
+func newCBCReader(r io.Reader, key, iv []byte) (*cbcReader, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("newCBCReader: %s", err.Error())
+	}
+	return &cbcReader{r: r, mode: cipher.NewCBCDecrypter(block, iv)}, nil
+}
+
+func (c *cbcReader) Read(p []byte) (int, error) {
+	for len(c.out) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		c.fill()
+	}
+	n := copy(p, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+func (c *cbcReader) fill() {
+	buf := make([]byte, cbcReadChunkSize)
+	n, err := c.r.Read(buf)
+	c.in = append(c.in, buf[:n]...)
+	switch {
+	case err == io.EOF:
+		if len(c.in)%aes.BlockSize != 0 {
+			c.err = errors.New("cbcReader: encrypted data is not a multiple of the block size")
+			return
+		}
+		c.mode.CryptBlocks(c.in, c.in)
+		c.out, c.err = pkcs7Unpad(c.in)
+		if c.err == nil {
+			c.err = io.EOF
+		}
+		c.in = nil
+	case err != nil:
+		c.err = err
+	default:
+		// the last block is kept until EOF because it holds the padding
+		k := (len(c.in) - 1) / aes.BlockSize * aes.BlockSize
+		if k <= 0 {
+			return
+		}
+		c.out = make([]byte, k)
+		c.mode.CryptBlocks(c.out, c.in[:k])
+		c.in = append(c.in[:0], c.in[k:]...)
+	}
+}
+
+func pkcs7Unpad(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return b, nil
+	}
+	n := int(b[len(b)-1])
+	if n == 0 || n > aes.BlockSize || n > len(b) {
+		return nil, errors.New("pkcs7Unpad: wrong padding")
+	}
+	for _, p := range b[len(b)-n:] {
+		if int(p) != n {
+			return nil, errors.New("pkcs7Unpad: wrong padding")
+		}
+	}
+	return b[:len(b)-n], nil
+}
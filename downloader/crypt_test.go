@@ -0,0 +1,185 @@
+package downloader
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func encryptCBC(t *testing.T, data, key, iv []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := aes.BlockSize - len(data)%aes.BlockSize
+	padded := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(n)}, n)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+	return padded
+}
+
+func TestCBCReader(t *testing.T) {
+	key, iv := []byte("0123456789abcdef"), []byte("fedcba9876543210")
+	for _, size := range []int{0, 1, 15, 16, 17, 188 * 1000, cbcReadChunkSize + 5} {
+		data := make([]byte, size)
+		rand.Read(data)
+		enc := encryptCBC(t, data, key, iv)
+		cr, err := newCBCReader(iotest.HalfReader(bytes.NewReader(enc)), key, iv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(cr)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("cbcReader: test failed for %d bytes. got %d bytes. err: %v", size, len(got), err)
+		}
+	}
+
+	cr, _ := newCBCReader(bytes.NewReader(make([]byte, 17)), key, iv)
+	if _, err := ioutil.ReadAll(cr); err == nil {
+		t.Errorf("cbcReader: test failed. want an error for data that is not a multiple of the block size")
+	}
+}
+
+func TestSegmentIV(t *testing.T) {
+	seg := segment{sequence: 258, key: &segmentKey{method: keyMethodAES128}}
+	want := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2}
+	if got := segmentIV(seg); !bytes.Equal(got, want) {
+		t.Errorf("segmentIV: test failed. got: %v. want: %v", got, want)
+	}
+	seg.key.iv = []byte("fedcba9876543210")
+	if got := segmentIV(seg); !bytes.Equal(got, seg.key.iv) {
+		t.Errorf("segmentIV: test failed. got: %v. want: %v", got, seg.key.iv)
+	}
+}
+
+func TestParseEncryptedMediaPlaylist(t *testing.T) {
+	data := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:7
+#EXTINF:10,
+0.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin",IV=0x000102030405060708090A0B0C0D0E0F
+#EXTINF:10,
+1.ts
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:10,
+2.ts
+`
+	base, _ := url.Parse("https://example.com/v/index.m3u8")
+	mp, err := parseMediaPlaylist(base, []byte(data))
+	if err != nil {
+		t.Fatalf("parseMediaPlaylist: test failed. got an error: %s", err.Error())
+	}
+	want := []segment{
+		{uri: "https://example.com/v/0.ts", duration: 10, sequence: 7},
+		{uri: "https://example.com/v/1.ts", duration: 10, sequence: 8, key: &segmentKey{
+			method: keyMethodAES128,
+			uri:    "https://example.com/v/key.bin",
+			iv:     []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+		}},
+		{uri: "https://example.com/v/2.ts", duration: 10, sequence: 9},
+	}
+	if !reflect.DeepEqual(mp.segments, want) {
+		t.Errorf("parseMediaPlaylist: test failed. got: %+v. want: %+v", mp.segments, want)
+	}
+}
+
+func TestDecryptSegment(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(key)
+	}))
+	defer srv.Close()
+
+	data := []byte("some segment data")
+	for i := 0; i < 2; i++ {
+		seg := segment{sequence: 3, key: &segmentKey{method: keyMethodAES128, uri: srv.URL + "/key"}}
+		r, err := decryptSegment(bytes.NewReader(encryptCBC(t, data, key, segmentIV(seg))), seg)
+		if err != nil {
+			t.Fatalf("decryptSegment: test failed. got an error: %s", err.Error())
+		}
+		if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("decryptSegment: test failed. got: %q. want: %q. err: %v", got, data, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("fetchKey: test failed. key was requested %d times. want: 1", requests)
+	}
+
+	seg := segment{key: &segmentKey{method: "SAMPLE-AES", uri: srv.URL + "/key"}}
+	if _, err := decryptSegment(bytes.NewReader(nil), seg); err == nil {
+		t.Errorf("decryptSegment: test failed. want an error for SAMPLE-AES")
+	}
+}
+
+func TestFetchKeyConcurrent(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	slow := make(chan struct{})
+	var mu sync.Mutex
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/slow":
+			<-slow
+		case r.URL.Path == "/broken" && n == 1:
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(key)
+	}))
+	defer srv.Close()
+	defer close(slow)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fetchKey(srv.URL + "/slow")
+		}()
+	}
+	// a slow key must not block other keys
+	done := make(chan error, 1)
+	go func() {
+		_, err := fetchKey(srv.URL + "/fast")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("fetchKey: test failed. got an error: %s", err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("fetchKey: test failed. fetching of another key is blocked")
+	}
+
+	if _, err := fetchKey(srv.URL + "/broken"); err == nil {
+		t.Errorf("fetchKey: test failed. want an error for 500 code")
+	}
+	if k, err := fetchKey(srv.URL + "/broken"); err != nil || !bytes.Equal(k, key) {
+		t.Errorf("fetchKey: test failed. failed key must be requested again. got: %q. err: %v", k, err)
+	}
+
+	slow <- struct{}{}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if requests["/slow"] != 1 {
+		t.Errorf("fetchKey: test failed. key was requested %d times. want: 1", requests["/slow"])
+	}
+}
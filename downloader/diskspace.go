@@ -0,0 +1,136 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// DiskSpaceCheck is a flag that makes downloading refuse to start without enough free disk space.
+// If unset, only a warning is shown
+var DiskSpaceCheck = true
+
+var (
+	errNotEnoughSpace   = errors.New("not enough free disk space")
+	errDiskSpaceUnknown = errors.New("free disk space is unknown on this platform")
+)
+
+// diskSpaceMargin is a part of estimated size which is added to it before warning about low disk space,
+// since BANDWIDTH is a peak value and the estimate is rough
+const diskSpaceMargin = 0.1
+
+// estimateSize estimates size of segments in bytes. Bandwidth is the BANDWIDTH of the variant in bits per second.
+// Without it size of the first segment is used. 0 means the size is unknown
+func estimateSize(bandwidth int, segs []segment) uint64 {
+	duration := 0.
+	for _, s := range segs {
+		duration += s.duration
+	}
+	if bandwidth > 0 {
+		return uint64(float64(bandwidth) / 8 * duration)
+	}
+	if len(segs) == 0 || segs[0].duration <= 0 {
+		return 0
+	}
+	if br := segs[0].byteRange; br != nil {
+		return uint64(float64(br.length) / segs[0].duration * duration)
+	}
+	size, err := segmentSize(segs[0].uri)
+	if err != nil {
+		logger.Debug("could not estimate size", "err", err)
+		return 0
+	}
+	return uint64(float64(size) / segs[0].duration * duration)
+}
+
+// segmentSize asks the server for Content-Length of the segment without downloading it.
+// The request has user defined headers and cookies like segment requests
+func segmentSize(link string) (int64, error) {
+	req, err := newRequest("HEAD", link, nil)
+	if err != nil {
+		return 0, fmt.Errorf("segmentSize: cannot create request. %s", err.Error())
+	}
+	setMediaHeaders(req)
+	resp, err := doRequest(req, HTTP.RequestTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("segmentSize: cannot retrieve segment headers. %s", err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength <= 0 {
+		return 0, fmt.Errorf("segmentSize: server responded with %d code and %d length", resp.StatusCode, resp.ContentLength)
+	}
+	return resp.ContentLength, nil
+}
+
+// diskNeed is space required on a single filesystem
+type diskNeed struct {
+	dir  string
+	need uint64
+	free uint64
+}
+
+// diskNeeds returns space required for segments in tmpDir and the output file in outDir.
+// Both exist while they are being combined, so one filesystem needs twice the size.
+// With a transcoding profile segments are combined into a file in tmpDir first, which needs the size once more
+func diskNeeds(tmpDir, outDir string, size uint64) ([]diskNeed, error) {
+	tmpSize := size
+	if Transcode != "" {
+		tmpSize += size
+	}
+	tmpFree, tmpDev, err := diskFree(tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	outFree, outDev, err := diskFree(outDir)
+	if err != nil {
+		return nil, err
+	}
+	if tmpDev == outDev {
+		return []diskNeed{{dir: tmpDir, need: tmpSize + size, free: tmpFree}}, nil
+	}
+	return []diskNeed{
+		{dir: tmpDir, need: tmpSize, free: tmpFree},
+		{dir: outDir, need: size, free: outFree},
+	}, nil
+}
+
+// checkDiskSpace warns about low free disk space and refuses to start without enough of it if DiskSpaceCheck is set
+func checkDiskSpace(tmpDir, outDir string, size uint64) error {
+	needs, err := diskNeeds(tmpDir, outDir, size)
+	if errors.Is(err, errDiskSpaceUnknown) {
+		logger.Debug("skipping disk space check", "err", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, d := range needs {
+		abs, _ := filepath.Abs(d.dir)
+		switch {
+		case d.free < d.need && DiskSpaceCheck:
+			return fmt.Errorf("checkDiskSpace: %w in %s. Need about %s, available %s", errNotEnoughSpace, abs, formatSize(d.need), formatSize(d.free))
+		case d.free < d.need+uint64(float64(d.need)*diskSpaceMargin):
+			fmt.Fprintf(os.Stderr, "Warning: download needs about %s in %s, but only %s is available\n", formatSize(d.need), abs, formatSize(d.free))
+		}
+	}
+	return nil
+}
+
+// formatSize formats size in bytes like 1.5G. K, M and G are 1024 based
+func formatSize(size uint64) string {
+	units := []string{"K", "M", "G", "T"}
+	if size < 1024 {
+		return strconv.FormatUint(size, 10) + "B"
+	}
+	s, unit := float64(size)/1024, units[0]
+	for _, u := range units[1:] {
+		if s < 1024 {
+			break
+		}
+		s, unit = s/1024, u
+	}
+	return strconv.FormatFloat(s, 'f', 1, 64) + unit
+}
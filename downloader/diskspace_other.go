@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package downloader
+
+func diskFree(dir string) (free uint64, dev uint64, err error) {
+	return 0, 0, errDiskSpaceUnknown
+}
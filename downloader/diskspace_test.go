@@ -0,0 +1,108 @@
+package downloader
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestEstimateSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "HEAD" {
+			t.Errorf("estimateSize: test failed. got %s request. want HEAD", r.Method)
+		}
+		// the source is reachable only with user defined headers and cookies
+		if r.Header.Get("Referer") != "https://example.com" || r.Header.Get("Cookie") != "session=abc" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Length", "1000000")
+	}))
+	defer srv.Close()
+	defer func(h http.Header, c string) { Headers, Cookies = h, c }(Headers, Cookies)
+	Headers = http.Header{"Referer": {"https://example.com"}}
+	Cookies = "session=abc"
+
+	segs := []segment{
+		{uri: srv.URL + "/0.ts", duration: 10},
+		{uri: srv.URL + "/1.ts", duration: 10},
+		{uri: srv.URL + "/2.ts", duration: 5},
+	}
+	cases := []struct {
+		bandwidth int
+		segs      []segment
+		want      uint64
+	}{
+		{bandwidth: 8000000, segs: segs, want: 25000000},
+		{bandwidth: 0, segs: segs, want: 2500000},
+		{bandwidth: 0, segs: []segment{{uri: srv.URL + "/0.ts"}}, want: 0},
+		{bandwidth: 8000000, segs: nil, want: 0},
+	}
+	for _, c := range cases {
+		got := estimateSize(c.bandwidth, c.segs)
+		if got != c.want {
+			t.Errorf("estimateSize: test failed. got: %d. want: %d", got, c.want)
+		}
+	}
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ttvldr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	free, _, err := diskFree(dir)
+	if errors.Is(err, errDiskSpaceUnknown) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	needs, err := diskNeeds(dir, dir, 100)
+	if err != nil || len(needs) != 1 || needs[0].need != 200 {
+		t.Errorf("diskNeeds: test failed. got: %v, %v. want single filesystem needing 200 bytes", needs, err)
+	}
+	defer func(tr string) { Transcode = tr }(Transcode)
+	Transcode = "h264-crf23-medium"
+	needs, err = diskNeeds(dir, dir, 100)
+	if err != nil || len(needs) != 1 || needs[0].need != 300 {
+		t.Errorf("diskNeeds: test failed with transcoding. got: %v, %v. want single filesystem needing 300 bytes", needs, err)
+	}
+	Transcode = ""
+	if err = checkDiskSpace(dir, dir, 1); err != nil {
+		t.Errorf("checkDiskSpace: test failed. got an error for 1 byte: %s", err.Error())
+	}
+	if err = checkDiskSpace(dir, dir, free); !errors.Is(err, errNotEnoughSpace) {
+		t.Errorf("checkDiskSpace: test failed. got: %v. want: %v", err, errNotEnoughSpace)
+	}
+	defer func(c bool) { DiskSpaceCheck = c }(DiskSpaceCheck)
+	DiskSpaceCheck = false
+	if err = checkDiskSpace(dir, dir, free); err != nil {
+		t.Errorf("checkDiskSpace: test failed. got an error with disabled check: %s", err.Error())
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := []struct {
+		input uint64
+		want  string
+	}{
+		{input: 0, want: "0B"},
+		{input: 1023, want: "1023B"},
+		{input: 1536, want: "1.5K"},
+		{input: 5 << 20, want: "5.0M"},
+		{input: 3 << 30, want: "3.0G"},
+		{input: 2 << 40, want: "2.0T"},
+	}
+	for _, c := range cases {
+		got := formatSize(c.input)
+		if got != c.want {
+			t.Errorf("formatSize: test failed. got: %s. want: %s", got, c.want)
+		}
+	}
+}
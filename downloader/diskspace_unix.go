@@ -0,0 +1,26 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// diskFree returns free space available to the user and ID of the filesystem of the directory
+func diskFree(dir string) (free uint64, dev uint64, err error) {
+	var st syscall.Statfs_t
+	if err = syscall.Statfs(dir, &st); err != nil {
+		return 0, 0, fmt.Errorf("diskFree: cannot get filesystem stats of %s. %s", dir, err.Error())
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("diskFree: %s", err.Error())
+	}
+	if sys, ok := fi.Sys().(*syscall.Stat_t); ok {
+		dev = uint64(sys.Dev)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), dev, nil
+}
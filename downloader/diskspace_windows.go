@@ -0,0 +1,31 @@
+package downloader
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceExW = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// diskFree returns free space available to the user and ID of the volume of the directory
+func diskFree(dir string) (free uint64, dev uint64, err error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("diskFree: %s", err.Error())
+	}
+	p, err := syscall.UTF16PtrFromString(abs)
+	if err != nil {
+		return 0, 0, fmt.Errorf("diskFree: %s", err.Error())
+	}
+	r, _, e := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&free)), 0, 0)
+	if r == 0 {
+		return 0, 0, fmt.Errorf("diskFree: cannot get free space of %s. %s", dir, e.Error())
+	}
+	h := fnv.New64a()
+	h.Write([]byte(strings.ToLower(filepath.VolumeName(abs))))
+	return free, h.Sum64(), nil
+}
@@ -2,17 +2,19 @@ package downloader
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log/slog"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -21,26 +23,41 @@ import (
 )
 
 const (
-	twitchClient           = "o4m8ilgpeewree25zlyzr1noba1j7t"
-	defaultQuality         = "chunked"
-	tsExtension            = ".ts"
-	regTSfile              = ".+[.]ts"
-	regQualityAndM3U8List  = "(VIDEO=\\\".*)\\n.*(\\.m3u8)"
-	regDuration            = "#EXTINF:(\\d+)[.].+"
-	targetDurationStrBegin = "TARGETDURATION:"
-	targetDurationStrEnd   = "\n#ID3"
-	newAPIGetVideo         = "https://api.twitch.tv/helix/videos?id="
-	oldAPIGetVideo         = "https://api.twitch.tv/api/vods/%VODIDREPLACER%/access_token?&client_id="
-	ffmpegBinary           = "ffmpeg"
-	goroutinsLimit         = 8
+	twitchClient   = "o4m8ilgpeewree25zlyzr1noba1j7t"
+	defaultQuality = "chunked"
+	tsExtension    = ".ts"
+	oldAPIGetVideo = "https://api.twitch.tv/api/vods/%VODIDREPLACER%/access_token?&client_id="
+	usherVODAPI    = "http://usher.twitch.tv/vod/"
+	ffmpegBinary   = "ffmpeg"
+	containerMP4   = "mp4"
+	containerMKV   = "mkv"
+	containerM4A   = "m4a"
+	goroutinsLimit = 8
+	partExtension  = ".part"
 )
 
 var (
 	sem = make(chan struct{}, goroutinsLimit)
-	// Debug is a flag that enables debug prints
-	Debug bool
 	// TimeF is a flag that enables time prints
 	TimeF bool
+	// Debug is a flag that enables debug prints.
+	//
+	// Deprecated: use ConfigureLogging with slog.LevelDebug. Debug only lowers the level of the logger in use
+	Debug bool
+	// Container defines the format of the output file: "mp4" or "mkv"
+	Container = containerMP4
+	// AudioOnly is a flag that downloads only audio into m4a file. Without audio only quality
+	// the lowest video quality is downloaded and audio is extracted from it
+	AudioOnly bool
+	// TempDir is a directory for temporary files. Put it on a fast disk
+	TempDir = "."
+	// OutputDir is a directory for the output file, chat replay and subtitles
+	OutputDir = "."
+	// OAuthToken is a user OAuth token used to access subscriber-only and restricted VODs
+	OAuthToken string
+
+	errVODRestricted = errors.New("VOD is restricted for this account")
+	errBadOAuthToken = errors.New("OAuth token is invalid or expired")
 )
 
 func init() {
@@ -63,147 +80,116 @@ func init() {
 	}
 }
 
-func getToken(vodID string) (token string, sig string, err error) {
-	twitchAPIv2 := strings.Replace(oldAPIGetVideo, "%VODIDREPLACER%", vodID, 1)
-	twitchAPIv2 += twitchClient
-	debugPrintf("\nLink to v2 API: %s\n", twitchAPIv2)
-	resp, err := http.Get(twitchAPIv2)
-	if err != nil {
-		return "", "", fmt.Errorf("getToken: cannot get twitch API v2 token. %s", err.Error())
-	}
-	defer resp.Body.Close()
+func replaceVODID(api, vodID string) string {
+	return strings.Replace(api, "%VODIDREPLACER%", vodID, 1)
+}
 
-	var data interface{}
-	dec := json.NewDecoder(resp.Body)
-	err = dec.Decode(&data)
+type playlistInfo struct {
+	quality   string
+	link      string
+	bandwidth int
+}
+
+func getUsherList(token, sig, vodID string) ([]playlistInfo, error) {
+	vs, err := getUsherVariants(token, sig, vodID)
 	if err != nil {
-		return "", "", fmt.Errorf("getToken: cannot decode data. %s", err.Error())
-	}
-	cast, ok := data.(map[string]interface{})
-	if !ok {
-		return "", "", errors.New("getToken: cannot cast data to map[string]interface{}")
+		return nil, err
 	}
-	token = fmt.Sprintf("%v", cast["token"])
-	sig = fmt.Sprintf("%v", cast["sig"])
-	debugPrintf("\nToken: %s. Sig: %s\n", token, sig)
-	return token, sig, nil
+	return variantsToPlaylistInfo(vs), nil
 }
 
-type playlistInfo struct {
-	quality string
-	link    string
+// usherURL returns Usher API link of the VOD playlist. Token is JSON, so it must be escaped
+// to keep the link valid and to let logs redact it entirely
+func usherURL(vodID, token, sig string) string {
+	q := url.Values{
+		"nauthsig":     {sig},
+		"nauth":        {token},
+		"allow_source": {"true"},
+	}
+	return usherVODAPI + url.PathEscape(vodID) + "?" + q.Encode()
 }
 
-func getUsherList(token, sig, vodID string) ([]playlistInfo, error) {
-	usherAPI := fmt.Sprintf("http://usher.twitch.tv/vod/%v?nauthsig=%v&nauth=%v&allow_source=true", vodID, sig, token)
-	debugPrintf("\nLink to Usher API: %s\n", usherAPI)
-	resp, err := http.Get(usherAPI)
+// getUsherVariants returns all renditions of the VOD from Usher API
+func getUsherVariants(token, sig, vodID string) ([]variant, error) {
+	usherAPI := usherURL(vodID, token, sig)
+	logger.Debug("requesting Usher API", "url", usherAPI)
+	resp, err := httpGet(usherAPI)
 	if err != nil {
-		return nil, fmt.Errorf("getUsherList: cannot get usher API data. %s", err.Error())
+		return nil, fmt.Errorf("getUsherVariants: cannot get usher API data. %s", err.Error())
 	}
 	defer resp.Body.Close()
 
 	resStr, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("getUsherList: cannot read response blob. %s", err.Error())
-	}
-	debugPrintf("\nUsher API response string: %s\n", resStr)
-	reg := regexp.MustCompile(regQualityAndM3U8List)
-	matches := reg.FindAllString(string(resStr), -1)
-	if len(matches) == 0 {
-		return nil, errors.New("getUsherList: no matches in M3U8 lists info")
-	}
-	m := make([]playlistInfo, 0, len(matches))
-	for _, str := range matches {
-		tmp := strings.Split(str, "\n")
-		q := tmp[0][strings.Index(tmp[0], "\"")+1 : strings.LastIndex(tmp[0], "\"")]
+		return nil, fmt.Errorf("getUsherVariants: cannot read response blob. %s", err.Error())
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		// usher answers with [{"error":"...","error_code":"vod_manifest_restricted",...}]
+		if bytes.Contains(resStr, []byte("restricted")) {
+			return nil, fmt.Errorf("getUsherVariants: %w", errVODRestricted)
+		}
+		return nil, fmt.Errorf("getUsherVariants: access denied. %s", resStr)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getUsherVariants: server responded with %d code. %s", resp.StatusCode, resStr)
+	}
+	logger.Debug("Usher API response", "body", string(resStr))
+	vs, err := parseMasterPlaylist(resp.Request.URL, resStr)
+	if err != nil {
+		return nil, fmt.Errorf("getUsherVariants: no matches in M3U8 lists info. %s", err.Error())
+	}
+	return vs, nil
+}
+
+func variantsToPlaylistInfo(vs []variant) []playlistInfo {
+	m := make([]playlistInfo, 0, len(vs))
+	for _, v := range vs {
 		m = append(m, playlistInfo{
-			quality: q,
-			link:    tmp[1],
+			quality:   v.name,
+			link:      v.uri,
+			bandwidth: v.bandwidth,
 		})
 	}
-	return m, nil
+	return m
 }
 
 func connectTwitch(vodID string) ([]playlistInfo, error) {
-	token, sig, err := getToken(vodID)
+	vs, err := connectTwitchVariants(vodID)
 	if err != nil {
 		return nil, err
 	}
-	pi, err := getUsherList(token, sig, vodID)
-	if err != nil {
-		return nil, err
-	}
-
-	return pi, nil
+	return variantsToPlaylistInfo(vs), nil
 }
 
-func getTSFromM3U8List(list string) (tsFiles []string, targetDuration int, err error) {
-	resp, err := http.Get(list)
-	if err != nil {
-		return nil, 0, fmt.Errorf("getTSFromM3U8List: cannot retrieve given m3u8 list. %s", err.Error())
-	}
-	defer resp.Body.Close()
-
-	listStr, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, 0, fmt.Errorf("getTSFromM3U8List: cannot read list data. %s", err.Error())
-	}
-	tdStr := string(listStr)
-	bc, ec := strings.Index(tdStr, targetDurationStrBegin)+len(targetDurationStrBegin), strings.Index(tdStr, targetDurationStrEnd)
-	targetDuration, err = strconv.Atoi(tdStr[bc:ec])
+// connectTwitchVariants is connectTwitch which returns full info about renditions
+func connectTwitchVariants(vodID string) ([]variant, error) {
+	token, sig, err := getToken(vodID)
 	if err != nil {
-		return nil, 0, fmt.Errorf("getTSFromM3U8List: cannot cast TARGETDURATION to type int. %s", err.Error())
-	}
-	reg := regexp.MustCompile(regTSfile)
-	matches := reg.FindAllString(string(listStr), -1)
-	if len(matches) == 0 {
-		return nil, 0, errors.New("getTSFromM3U8List: no .ts entries in the list")
+		return nil, err
 	}
-	return matches, targetDuration, nil
+	return getUsherVariants(token, sig, vodID)
 }
 
-func getM3U8LinkByQiality(pi []playlistInfo, quality string) string {
-	list, ok := checkListByQuality(pi, quality)
-	if ok {
-		tmp := quality
-		if quality == defaultQuality {
-			tmp = "source"
-		}
-		fmt.Printf("Downloading in %s quality...\n", tmp)
-		return list
+// chooseQuality returns the playlist link of the variant chosen by quality rules, see selectQuality
+// With AudioOnly quality is ignored
+func chooseQuality(vs []variant, quality string) (string, error) {
+	if AudioOnly {
+		quality = audioOnlyQuality
 	}
-	// try to find best quality
-	fmt.Printf("No such quality: %s. Trying to find the best one...\n", quality)
-	if quality != defaultQuality {
-		quality = defaultQuality
-		list, ok = checkListByQuality(pi, quality)
+	v, err := selectQuality(vs, quality)
+	if err != nil {
+		return "", err
 	}
-	if ok {
-		fmt.Println("Found source quality! Downloading in it...")
-		return list
+	name := v.name
+	if name == defaultQuality {
+		name = qualitySource
 	}
-	fps, fpsMax, resol, resolMax := 0, 0, 0, 0
-	for _, p := range pi {
-		tmp := strings.Split(p.quality, "p")
-		if len(tmp) > 1 { //fps
-			fps, _ = strconv.Atoi(tmp[1])
-		} else {
-			fps = 0
-		}
-		resol, _ = strconv.Atoi(tmp[0])
-		if resol > resolMax || (fps > fpsMax && resol == resolMax) {
-			resolMax, fpsMax, quality = resol, fps, p.quality
-		}
+	if AudioOnly && !isAudioOnly(v) {
+		fmt.Printf("No audio only quality. Extracting audio from %s quality...\n", name)
+		return v.uri, nil
 	}
-	list, ok = checkListByQuality(pi, quality)
-	if ok {
-		fmt.Printf("Found %s quality as best! Downloading in it...\n", quality)
-	} else { // no opts at all
-		fmt.Println("No quality options are available for this VOD")
-		os.Exit(1)
-	}
-	return list
+	fmt.Printf("Downloading in %s quality...\n", name)
+	return v.uri, nil
 }
 
 func checkListByQuality(pi []playlistInfo, quality string) (list string, ok bool) {
@@ -219,59 +205,125 @@ func checkListByQuality(pi []playlistInfo, quality string) (list string, ok bool
 	return list, ok
 }
 
-func downloadTS(path string, base string, vodID string, tsName string, tsNum string, wg *sync.WaitGroup) {
+// playlistByLink returns info of the playlist with the given link
+func playlistByLink(pi []playlistInfo, link string) playlistInfo {
+	for _, p := range pi {
+		if p.link == link {
+			return p
+		}
+	}
+	return playlistInfo{link: link}
+}
+
+func downloadTS(path string, name string, seg segment, tsNum string, pr *playlistRefresher, log *slog.Logger, wg *sync.WaitGroup) {
 	defer wg.Done()
 	<-sem
-	tsURL := base + tsName
+	defer func() { sem <- struct{}{} }()
+	tsName := segmentName(seg.uri)
+	log = log.With("segment", tsNum)
+	tsFullOSName := filepath.Join(path, name+"_"+tsNum+tsExtension)
 	retryMax := 5
-	var data []byte
-LOOP:
+	gen := 0
 	for retry := 0; retry < retryMax; retry++ {
-		data = nil
 		if retry > 0 {
-			debugPrintf("%d try to download %s\n", retry+1, tsName)
+			log.Debug("retrying segment", "try", retry+1)
 		}
-		resp, err := http.Get(tsURL)
+		seg, gen = pr.latest(seg, gen)
+		resp, err := segmentRangeGet(seg.uri, seg.byteRange)
 		if err != nil {
-			fatalPrintf(err, "Could not download file %s\n", tsName)
+			if retry == retryMax-1 {
+				fatalPrintf(err, "Could not download file %s after %d tries\n", tsName, retryMax)
+			}
+			log.Warn("segment request failed", "try", retry+1, "err", err)
+			continue
+		}
+		if isAuthExpired(resp.StatusCode) && pr != nil {
+			resp.Body.Close()
+			log.Info("segment access expired, renewing the playlist", "status", resp.StatusCode)
+			if seg, gen, err = pr.renew(seg, gen); err != nil {
+				fatalPrintf(err, "Access to file %s has expired and could not be renewed\n", tsName)
+			}
+			continue
+		}
+		if seg.byteRange != nil && resp.StatusCode == http.StatusOK {
+			resp.Body.Close()
+			fatalPrintf(fmt.Errorf("downloadTS: server ignored Range header for %s", tsName), "\nServer doesn't support byte ranges of file %s\n", tsName)
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			data, err = ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != rangeStatus(seg.byteRange) {
+			data, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
 			if err != nil {
 				fatalPrintf(err, "Could not read file %s. Server returned wrong data\n", tsName)
 			}
-			debugPrintf("\nDrop %s. Server response with %d code. Read data %s\n", tsName, resp.StatusCode, string(data))
+			log.Warn("segment dropped", "status", resp.StatusCode, "body", string(data))
 			return
 		}
-		data, err = ioutil.ReadAll(resp.Body)
+		err = saveSegment(resp, seg, tsFullOSName)
+		resp.Body.Close()
+		if err == nil {
+			fmt.Print(".")
+			return
+		}
+		if retry == retryMax-1 {
+			fatalPrintf(err, "\nCould not download file %s after %d tries\n", tsName, retryMax)
+		}
+		log.Warn("segment download failed", "try", retry+1, "err", err)
+	}
+	fatalPrintf(fmt.Errorf("downloadTS: no tries left for %s", tsName), "\nCould not download file %s after %d tries\n", tsName, retryMax)
+}
+
+// saveSegment streams the segment into file through a temporary file,
+// so a partially downloaded segment never appears under its name.
+// Media initialization section of the segment is written first
+func saveSegment(resp *http.Response, seg segment, file string) error {
+	cr := &countingReader{r: resp.Body}
+	body, err := decryptSegment(limitedReader{cr}, seg)
+	if err != nil {
+		return fmt.Errorf("saveSegment: %s", err.Error())
+	}
+	if seg.init != nil {
+		init, err := fetchInit(seg.init)
 		if err != nil {
-			if retry == retryMax-1 {
-				fatalPrintf(err, "\nCould not download file %s after %d tries\n", tsName, retry)
-			} else {
-				debugPrintf("\nCould not download %s.\nError: %s\n", tsName, err.Error())
-			}
-		} else {
-			break LOOP
+			return fmt.Errorf("saveSegment: %s", err.Error())
 		}
+		body = io.MultiReader(bytes.NewReader(init), body)
 	}
-	tsFullOSName := filepath.Join(path, vodID+"_"+tsNum+tsExtension)
-	if err := ioutil.WriteFile(tsFullOSName, data, 0400); err != nil {
-		fatalPrintf(err, "Could not write file %s in %s\n", tsName, path)
+	part := file + partExtension
+	os.Remove(part)
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+	if err != nil {
+		return fmt.Errorf("saveSegment: could not create file. %s", err.Error())
+	}
+	_, err = io.Copy(f, body)
+	if err == nil && resp.ContentLength >= 0 && cr.n != resp.ContentLength {
+		err = fmt.Errorf("got %d bytes of %d", cr.n, resp.ContentLength)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(part, file)
+	}
+	if err != nil {
+		os.Remove(part)
+		return fmt.Errorf("saveSegment: could not save %s. %s", file, err.Error())
 	}
-	sem <- struct{}{}
-	fmt.Print(".")
+	return nil
 }
 
-func calcTSCountByTargetDuration(start, end string, targetDuration int) int {
-	ss := convertTimeToSeconds(start)
-	es := convertTimeToSeconds(end)
-	return ((es - ss) / targetDuration) + 1
+// countingReader counts bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
 }
 
-func calcStartTS(start string, targetDuration int) int {
-	ss := convertTimeToSeconds(start)
-	return ss / targetDuration
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
 }
 
 func convertTimeToSeconds(timeStr string) int {
@@ -365,107 +417,322 @@ func calcStartTSAndTSCount(start, end string, durations []float64) (tsStart int,
 	return
 }
 
-func getDurationsFromM3U8List(list string) ([]float64, error) {
-	resp, err := http.Get(list)
+// DownloadVOD download defined VOD from start time to end time with certain quality
+// Default value for start "0"; for end "-1"
+// Quality is a comma separated list of rules tried in order, e.g. "1080p60,720p60,best", see selectQuality.
+// Several qualities separated by + are downloaded together into files named with the quality, e.g. "chunked+480p30".
+// Output files are named with OutputName template.
+// It returns an error wrapping ErrNoQuality if no quality matches, other failures exit the program
+func DownloadVOD(vodID string, start string, end string, quality string) error {
+	checkOptions()
+	startT := time.Now()
+	vs, err := connectTwitchVariants(vodID)
+	endT := time.Since(startT)
 	if err != nil {
-		return nil, fmt.Errorf("getDurationsFromM3U8List: cannot retrieve given m3u8 list. %s", err.Error())
+		fatalConnectPrintf(err)
+	}
+	pi := variantsToPlaylistInfo(vs)
+	fmt.Println("Successfully connected to server")
+	for _, p := range pi {
+		logger.Debug("Usher API playlist", "vod", vodID, "quality", p.quality, "url", p.link)
+	}
+	if TimeF {
+		fmt.Printf("Connect time: %f seconds\n", endT.Seconds())
 	}
-	defer resp.Body.Close()
 
-	listStr, err := ioutil.ReadAll(resp.Body)
+	fmt.Println("Choosing quality...")
+	var pls []playlistInfo
+	selectors := []string{quality}
+	// with AudioOnly quality is ignored
+	if !AudioOnly {
+		selectors = qualitySelectors(vs, quality)
+	}
+	for _, q := range selectors {
+		link, err := chooseQuality(vs, q)
+		if err != nil {
+			return fmt.Errorf("DownloadVOD: %w", err)
+		}
+		if skipped := skippedQualities(vs, q); len(skipped) > 0 && !AudioOnly {
+			fmt.Fprintf(os.Stderr, "Only the first matching rule of %s is used, %s is not downloaded. Separate qualities with + to download several of them, e.g. chunked+480p30\n", q, strings.Join(skipped, ", "))
+		}
+		pl := playlistByLink(pi, link)
+		if containsPlaylist(pls, pl.link) {
+			fmt.Printf("%s quality is chosen twice. Downloading it once...\n", pl.quality)
+			continue
+		}
+		pls = append(pls, pl)
+	}
+	var chat *chatJob
+	if Chat {
+		chat = newChatJob(vodID, start, end)
+	}
+	names, err := outputNames(vodID, vs, pls)
 	if err != nil {
-		return nil, fmt.Errorf("getDurationsFromM3U8List: cannot read list data. %s", err.Error())
+		fatalPrintf(err, "Could not name the output file with -output-name template\n%s\n", err.Error())
 	}
-	reg := regexp.MustCompile(regDuration)
-	matches := reg.FindAllString(string(listStr), -1)
-	if len(matches) == 0 {
-		return nil, errors.New("getDurationsFromM3U8List: no matches while getting durations")
+	// all qualities share the free space, so it's checked once for their sum
+	ranges := make([]mediaRange, len(pls))
+	var size uint64
+	for i, pl := range pls {
+		ranges[i] = loadMedia(pl, start, end)
+		size += estimateSize(pl.bandwidth, ranges[i].segments())
 	}
-	durations := make([]float64, 0, len(matches))
-	for _, duration := range matches {
-		d, err := strconv.ParseFloat(duration, 64)
-		if err != nil {
-			return nil, fmt.Errorf("getDurationsFromM3U8List: cannot parse duration as float64. %s", err.Error())
+	prepareDirs(size)
+	handleInterrupt()
+	// qualities are downloaded together and share the limit of download workers
+	var wg sync.WaitGroup
+	for i, pl := range pls {
+		name := names[i]
+		relink := relinkByQuality(func() ([]playlistInfo, error) {
+			return connectTwitch(vodID)
+		}, pl.quality)
+		wg.Add(1)
+		go func(name string, pl playlistInfo, r mediaRange) {
+			defer wg.Done()
+			downloadMedia(name, vodID, pl, r, relink, chat)
+		}(name, pl, ranges[i])
+	}
+	wg.Wait()
+	return nil
+}
+
+func containsPlaylist(pls []playlistInfo, link string) bool {
+	for _, p := range pls {
+		if p.link == link {
+			return true
 		}
-		durations = append(durations, d)
 	}
-	return durations, nil
+	return false
 }
 
-// DownloadVOD download defined VOD from start time to end time with certain quality
-// Default value for start "0"; for end "-1"
-// Default value for quality if "chunked"
-func DownloadVOD(vodID string, start string, end string, quality string) {
-	startT := time.Now()
-	pi, err := connectTwitch(vodID)
-	endT := time.Since(startT)
+// DownloadPlaylist download video from a master or media m3u8 playlist URL from start time to end time.
+// It doesn't use Twitch API, so chat replay and metadata are unavailable.
+// Quality is used only if the link is a master playlist.
+// It returns an error wrapping ErrNoQuality if no quality matches, other failures exit the program
+func DownloadPlaylist(link string, start string, end string, quality string) error {
+	if len(splitQualities(quality)) > 1 {
+		return fmt.Errorf("DownloadPlaylist: several qualities %s can be downloaded only from Twitch VOD links", quality)
+	}
+	err := downloadPlaylist(link, start, end, func(vs []variant) (string, error) {
+		if qs := qualitySelectors(vs, quality); len(qs) > 1 && !AudioOnly {
+			return "", fmt.Errorf("several qualities %s can be downloaded only from Twitch VOD links", quality)
+		}
+		return chooseQuality(vs, quality)
+	})
 	if err != nil {
-		fatalPrintf(err, "There was an error while connecting to Twitch server\n")
+		return fmt.Errorf("DownloadPlaylist: %w", err)
 	}
-	fmt.Println("Successfully connected to server")
-	debugPrintf("\nUsher API playlists info:\n")
+	return nil
+}
+
+// downloadPlaylist fetches the playlist, chooses a variant with choose if it's a master playlist
+// and downloads the media playlist. Errors of choose are returned
+func downloadPlaylist(link, start, end string, choose func([]variant) (string, error)) error {
+	checkOptions()
+	if Chat || Metadata {
+		logger.Info("chat replay and metadata are unavailable for playlist links")
+		Chat, Subtitles, Metadata = false, "", false
+	}
+	base, data, err := fetchPlaylist(link)
+	if err != nil {
+		fatalPrintf(err, "Could not retrieve playlist %s\n", link)
+	}
+	pl := playlistInfo{link: link}
+	// media playlist may be served with fresh segment signatures on every request
+	relink := func() (string, error) {
+		return link, nil
+	}
+	if isMasterPlaylist(data) {
+		vs, err := parseMasterPlaylist(base, data)
+		if err != nil {
+			fatalPrintf(err, "Could not parse playlist %s\n", link)
+		}
+		fmt.Println("Choosing quality...")
+		master := link
+		chosen, err := choose(vs)
+		if err != nil {
+			return err
+		}
+		pl = playlistByLink(variantsToPlaylistInfo(vs), chosen)
+		// master playlist may sign media playlist links, so ask it again when they expire
+		relink = relinkByQuality(func() ([]playlistInfo, error) {
+			base, data, err := fetchPlaylist(master)
+			if err != nil {
+				return nil, err
+			}
+			vs, err := parseMasterPlaylist(base, data)
+			if err != nil {
+				return nil, err
+			}
+			return variantsToPlaylistInfo(vs), nil
+		}, pl.quality)
+	}
+	r := loadMedia(pl, start, end)
+	prepareDirs(estimateSize(pl.bandwidth, r.segments()))
+	handleInterrupt()
+	downloadMedia(playlistName(pl.link), "", pl, r, relink, nil)
+	return nil
+}
+
+// playlistName makes a name for the output file of a playlist, e.g. index-dvr_20181013_214701
+func playlistName(link string) string {
+	name := "playlist"
+	if u, err := url.Parse(link); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		name = strings.TrimSuffix(path.Base(u.Path), path.Ext(u.Path))
+	}
+	return name + "_" + time.Now().Format("20060102_150405")
+}
+
+func checkOptions() {
 	if Debug {
-		for _, p := range pi {
-			debugPrintf("Quality: %s. m3u8 link: %s\n", p.quality, p.link)
+		enableDebugLogs()
+	}
+	if Container != containerMP4 && Container != containerMKV {
+		fatalPrintf(fmt.Errorf("checkOptions: unknown container %s", Container), "Unknown output format %s. Use %s or %s\n", Container, containerMP4, containerMKV)
+	}
+	if Subtitles != "" && Subtitles != subtitlesASS && Subtitles != subtitlesSRT {
+		fatalPrintf(fmt.Errorf("checkOptions: unknown subtitles format %s", Subtitles), "Unknown subtitles format %s. Use %s or %s\n", Subtitles, subtitlesASS, subtitlesSRT)
+	}
+	if Subtitles == "" && MuxSubtitles {
+		Subtitles = subtitlesASS
+	}
+	if AudioOnly && MuxSubtitles {
+		logger.Info("subtitles are saved in a separate file in audio only mode")
+		MuxSubtitles = false
+	}
+	if Transcode != "" {
+		p, ok := transcodeProfiles[Transcode]
+		if !ok {
+			fatalPrintf(fmt.Errorf("checkOptions: unknown transcoding profile %s", Transcode), "Unknown transcoding profile %s. Use %s\n", Transcode, strings.Join(TranscodeProfiles(), ", "))
+		}
+		if AudioOnly && !p.audio {
+			fatalPrintf(fmt.Errorf("checkOptions: video profile %s in audio only mode", Transcode), "Transcoding profile %s encodes video, it can't be used with -audio-only\n", Transcode)
+		}
+		if p.audio && MuxSubtitles {
+			logger.Info("subtitles are saved in a separate file with audio transcoding profile")
+			MuxSubtitles = false
 		}
 	}
-	if TimeF {
-		fmt.Printf("Connect time: %f seconds\n", endT.Seconds())
+	if _, err := parseInfoTemplate(OutputName); err != nil {
+		fatalPrintf(err, "Wrong -output-name template. %s\n", err.Error())
 	}
+	if Subtitles != "" {
+		Chat = true
+	}
+}
 
-	startT = time.Now()
-	fmt.Println("Choosing quality...")
-	m3u8link := getM3U8LinkByQiality(pi, quality)
-	base := m3u8link[:strings.Index(m3u8link, quality)+len(quality)+1]
-	debugPrintf("\nChosen M3U8: %s. Base link: %s\n", m3u8link, base)
+// mediaRange is a part of the media playlist between start and end time
+type mediaRange struct {
+	mp           *mediaPlaylist
+	first, count int
+	// videoStart is position of the first segment in the VOD
+	videoStart float64
+}
+
+func (r mediaRange) segments() []segment {
+	return r.mp.segments[r.first : r.first+r.count]
+}
 
-	tsList, targetDuration, err := getTSFromM3U8List(m3u8link)
+// loadMedia fetches the media playlist and finds segments between start and end time
+func loadMedia(pl playlistInfo, start, end string) mediaRange {
+	log := logger.With("quality", pl.quality)
+	log.Debug("chosen playlist", "url", pl.link)
+	base, data, err := fetchPlaylist(pl.link)
 	if err != nil {
 		fatalPrintf(err, "There was an error while retreiving data\n")
 	}
-	debugPrintf("\nList of .ts files: %v\n", tsList)
+	mp, err := parseMediaPlaylist(base, data)
+	if err != nil {
+		fatalPrintf(err, "There was an error while retreiving data\n")
+	}
+	log.Debug("media playlist", "segments", len(mp.segments), "target_duration", mp.targetDuration)
+	for _, seg := range mp.segments {
+		if seg.key != nil && seg.key.method != keyMethodAES128 {
+			fatalPrintf(fmt.Errorf("loadMedia: encryption method %s is not supported", seg.key.method), "Segments are encrypted with %s. Only %s is supported\n", seg.key.method, keyMethodAES128)
+		}
+	}
 
-	tsCountStartEnd, tsStart := 0, 0
+	r := mediaRange{mp: mp}
 	if end != "-1" {
-		durations, err := getDurationsFromM3U8List(m3u8link)
-		if len(durations) != len(tsList) || err != nil {
-			tsStart, tsCountStartEnd = calcStartTS(start, targetDuration), calcTSCountByTargetDuration(start, end, targetDuration)
-		} else {
-			tsStart, tsCountStartEnd = calcStartTSAndTSCount(start, end, durations)
+		durations := mp.durations()
+		r.first, r.count = calcStartTSAndTSCount(start, end, durations)
+		for _, d := range durations[:r.first] {
+			r.videoStart += d
 		}
 	} else {
 		fmt.Println("Timestamps didn't defined. Downloading full VOD...")
-		_, tsCountStartEnd = tsStart, len(tsList)
+		r.count = len(mp.segments)
 	}
-	debugPrintf("\n.ts files to download: %d. Starting from %d file in m3u8\n", tsCountStartEnd, tsStart)
+	log.Debug("segments to download", "count", r.count, "first", r.first)
+	return r
+}
 
-	pwd := "."
-	path, err := ioutil.TempDir(pwd, vodID+"_")
+// prepareDirs creates TempDir and OutputDir and checks free space for downloads of size bytes in total
+func prepareDirs(size uint64) {
+	for _, dir := range []string{TempDir, OutputDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fatalPrintf(err, "Could not create directory %s\n", dir)
+		}
+	}
+	if size == 0 {
+		return
+	}
+	fmt.Printf("Estimated size: %s\n", formatSize(size))
+	if err := checkDiskSpace(TempDir, OutputDir, size); err != nil {
+		fatalPrintf(err, "%s\nFree some space or use -disk-check=false to download anyway\n", err.Error())
+	}
+}
+
+// downloadMedia downloads segments of the media playlist range and combines them in a single file name.mp4.
+// Metadata is downloaded only if vodID is set. Chat, if set, is chat replay shared by all downloads of the VOD.
+// relink, if set, returns a freshly signed link of the same playlist when segment URLs expire
+func downloadMedia(name, vodID string, pl playlistInfo, r mediaRange, relink func() (string, error), chat *chatJob) {
+	startT := time.Now()
+	log := logger.With("job", name)
+	if vodID != "" {
+		log = log.With("vod", vodID)
+	}
+	tsStart, tsCountStartEnd := r.first, r.count
+	path, err := ioutil.TempDir(TempDir, name+"_")
+	if err == nil {
+		// ffmpeg resolves relative paths in the list against the list directory
+		path, err = filepath.Abs(path)
+	}
 	if err != nil {
 		fatalPrintf(err, "Could not create temporary directory\n")
 	}
-	defer removeTemp(path)
-	sCh := make(chan os.Signal, 1)
-	signal.Notify(sCh, os.Interrupt, os.Kill)
-	go func(path string) {
-		<-sCh
-		fmt.Println("\nProgram was interrupted by user")
+	vodFile := freeFileName(filepath.Join(OutputDir, name), "."+outputExtension())
+	addTemp(path, vodFile+partExtension)
+	defer func() {
+		releaseTemp(path, vodFile+partExtension)
 		removeTemp(path)
-		os.Exit(1)
-	}(path)
+	}()
+	duration := 0.
+	for _, seg := range r.segments() {
+		duration += seg.duration
+	}
+	output, _ := filepath.Abs(vodFile)
+	job := startJob(name, vodID, pl.quality, output, duration)
 	fmt.Printf("Created new temorary directory %s\n", path)
-	endT = time.Since(startT)
+	endT := time.Since(startT)
 	if TimeF {
 		fmt.Printf("Preparations time: %f seconds\n", endT.Seconds())
 	}
 
+	if chat != nil {
+		chat.run(log)
+	}
+
 	startT = time.Now()
 	fmt.Println("Started downloading...")
+	var pr *playlistRefresher
+	if relink != nil {
+		pr = newPlaylistRefresher(relink)
+	}
 	var wg sync.WaitGroup
 	wg.Add(tsCountStartEnd)
 	for i := tsStart; i < (tsCountStartEnd + tsStart); i++ {
-		tsName, tsNum := tsList[i], strconv.Itoa(i)
-		go downloadTS(path, base, vodID, tsName, tsNum, &wg)
+		go downloadTS(path, name, r.mp.segments[i], strconv.Itoa(i), pr, log, &wg)
 	}
 	wg.Wait()
 	endT = time.Since(startT)
@@ -473,12 +740,55 @@ func DownloadVOD(vodID string, start string, end string, quality string) {
 		fmt.Printf("\nDownloading time: %f seconds", endT.Seconds())
 	}
 
+	subs := ""
+	if chat != nil {
+		subs = chat.wait(r.videoStart, log)
+	}
+	opts := muxOptions{}
+	if MuxSubtitles {
+		opts.subs = subs
+	}
+	if Metadata && vodID != "" {
+		vi, err := getVODInfo(vodID)
+		switch {
+		case err != nil && HelixClientSecret == "":
+			// metadata is on by default, but Helix API rejects requests without app access token
+			log.Debug("VOD info is unavailable without Helix credentials", "err", err)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "\nCould not retrieve VOD info. Output file will have no metadata\n")
+			log.Warn("VOD info request failed", "err", err)
+		default:
+			resolveStreamer(vi)
+			opts.metadata = muxMetadata(vi)
+			// -vn drops cover art along with video
+			if !AudioOnly {
+				if opts.cover, err = downloadCover(vi, path); err != nil {
+					fmt.Fprintf(os.Stderr, "\nCould not download VOD thumbnail. Output file will have no cover art\n")
+					log.Warn("cover download failed", "err", err)
+				}
+			}
+		}
+	}
+
 	startT = time.Now()
 	fmt.Println("\nConverting...")
-	err = concatffmpegFiles(path, vodID, tsStart, tsCountStartEnd)
+	// with a transcoding profile segments are combined in the temporary directory and encoded into vodFile
+	concatFile := vodFile
+	if Transcode != "" {
+		concatFile = filepath.Join(path, "concat."+Container)
+	}
+	err = concatffmpegFiles(path, name, concatFile, tsStart, tsCountStartEnd, opts)
 	if err != nil {
-		fatalPrintf(err, "FFMPEG could not combine files.\nPlease, remove temporary directory %s by hand\n", path)
+		fatalPrintf(err, "FFMPEG could not combine files\n")
+	}
+	if Transcode != "" {
+		fmt.Printf("Transcoding with %s profile...\n", Transcode)
+		if err = transcodeFile(concatFile, vodFile, duration); err != nil {
+			fatalPrintf(err, "FFMPEG could not transcode file\n")
+		}
 	}
+	fmt.Printf("Saved %s\n", vodFile)
+	job.finish()
 	endT = time.Since(startT)
 	if TimeF {
 		fmt.Printf("Converting time: %f seconds\n", endT.Seconds())
@@ -486,6 +796,62 @@ func DownloadVOD(vodID string, start string, end string, quality string) {
 	fmt.Println("Done")
 }
 
+var (
+	// tempFiles are temporary directories and partial output files of running downloads
+	tempFiles = struct {
+		sync.Mutex
+		paths map[string]struct{}
+	}{paths: map[string]struct{}{}}
+
+	interruptOnce sync.Once
+)
+
+// addTemp registers temporary paths of a download, so they are removed if the program exits before it's done
+func addTemp(paths ...string) {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	for _, p := range paths {
+		tempFiles.paths[p] = struct{}{}
+	}
+}
+
+// releaseTemp unregisters paths of a finished download
+func releaseTemp(paths ...string) {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	for _, p := range paths {
+		delete(tempFiles.paths, p)
+	}
+}
+
+// cleanupTemp removes temporary paths of all running downloads. It's called before the program exits with an error
+func cleanupTemp() {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	for p := range tempFiles.paths {
+		if err := os.RemoveAll(p); err != nil {
+			logger.Debug("could not remove temporary path", "path", p, "err", err)
+		}
+		delete(tempFiles.paths, p)
+	}
+}
+
+// handleInterrupt installs a single interrupt handler for all downloads,
+// which removes their temporary files and runs failed hooks
+func handleInterrupt() {
+	interruptOnce.Do(func() {
+		sCh := make(chan os.Signal, 1)
+		signal.Notify(sCh, os.Interrupt)
+		go func() {
+			<-sCh
+			fmt.Println("\nProgram was interrupted by user")
+			cleanupTemp()
+			failJobs(errors.New("interrupted by user"))
+			os.Exit(1)
+		}()
+	})
+}
+
 func removeTemp(path string) error {
 	abs, err := filepath.Abs(path)
 	if err != nil {
@@ -499,13 +865,13 @@ func removeTemp(path string) error {
 	return nil
 }
 
-func combineFilesInList(path string, vodID string, tsStart, tsCount int) (string, error) {
+func combineFilesInList(path string, name string, tsStart, tsCount int) (string, error) {
 	buf := bytes.NewBufferString("")
 	for i := tsStart; i < (tsCount + tsStart); i++ {
-		fname := fmt.Sprintf("file '%s'\n", filepath.Join(path, vodID+"_"+strconv.Itoa(i)+tsExtension))
+		fname := fmt.Sprintf("file '%s'\n", filepath.Join(path, name+"_"+strconv.Itoa(i)+tsExtension))
 		buf.WriteString(fname)
 	}
-	retList := filepath.Join(path, "_tmp_VOD_list_"+vodID)
+	retList := filepath.Join(path, "_tmp_VOD_list_"+name)
 	err := ioutil.WriteFile(retList, buf.Bytes(), 0400)
 	if err != nil {
 		return "", fmt.Errorf("combineFilesInList: could not write in file. %s", err.Error())
@@ -513,98 +879,157 @@ func combineFilesInList(path string, vodID string, tsStart, tsCount int) (string
 	return retList, nil
 }
 
-func concatffmpegFiles(path, vodID string, tsStart, tsCount int) error {
-	r := rand.New(rand.NewSource(time.Now().Unix()))
-	flist, err := combineFilesInList(path, vodID, tsStart, tsCount)
+// freeFileName returns name+ext or, if such file already exists, name with a random suffix
+func freeFileName(name, ext string) string {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	file := name + ext
+	_, err := os.Stat(file)
+	if err == nil || !os.IsNotExist(err) {
+		fname := name + "_" + strconv.Itoa(r.Intn(9999)) + ext
+		fmt.Printf("File %s already exists. Created new file %s\n", file, fname)
+		file = fname
+	}
+	return file
+}
+
+// muxOptions are extra streams and tags written into the output file
+type muxOptions struct {
+	subs     string
+	cover    string
+	metadata [][2]string
+}
+
+// concatffmpegFiles combines segments into vodFile. ffmpeg writes into vodFile.part,
+// which is renamed when it's done, so a half-written file never appears under the final name
+func concatffmpegFiles(path, name, vodFile string, tsStart, tsCount int, opts muxOptions) error {
+	flist, err := combineFilesInList(path, name, tsStart, tsCount)
 	if err != nil {
 		return err
 	}
-	vodFile := vodID + ".mp4"
-	_, err = os.Stat(vodID + ".mp4")
-	if err == nil || !os.IsNotExist(err) {
-		fname := vodID + "_" + strconv.Itoa(r.Intn(9999)) + ".mp4"
-		fmt.Printf("File %s already exists. Created new file %s\n", vodID+".mp4", fname)
-		vodFile = fname
-	}
-	cmdConcat := exec.Command(ffmpegBinary, strings.Fields("-f concat -safe 0 -i "+flist+" -c copy -fflags +genpts -bsf:a aac_adtstoasc "+vodFile)...)
+	partFile := vodFile + partExtension
+	args := ffmpegConcatArgs(flist, partFile, opts)
+	logger.Debug("running ffmpeg", "args", args)
+	cmdConcat := exec.Command(ffmpegBinary, args...)
 	cmdErr := bytes.NewBuffer(nil)
 	cmdConcat.Stderr = cmdErr
 	err = cmdConcat.Run()
 	if err != nil {
+		os.Remove(partFile)
 		return fmt.Errorf("concatffmpegFiles: ffmpeg returned error while concat: %s", cmdErr.String())
 	}
+	if err = os.Rename(partFile, vodFile); err != nil {
+		return fmt.Errorf("concatffmpegFiles: could not rename %s. %s", partFile, err.Error())
+	}
 	return nil
 }
 
-func debugPrintf(format string, opts ...interface{}) {
-	if Debug {
-		if len(format) > 0 {
-			fmt.Printf(format, opts...)
+// ffmpegConcatArgs returns ffmpeg arguments. Output format is set explicitly
+// since the output file has .part extension
+func ffmpegConcatArgs(flist, vodFile string, opts muxOptions) []string {
+	args := []string{"-f", "concat", "-safe", "0", "-i", flist}
+	// MKV keeps cover as an attachment, MP4 — as an attached picture stream
+	coverStream := opts.cover != "" && Container == containerMP4
+	inputs := 1
+	if opts.subs != "" {
+		args = append(args, "-i", opts.subs)
+		inputs++
+	}
+	if coverStream {
+		args = append(args, "-i", opts.cover)
+		inputs++
+	}
+	if inputs > 1 {
+		args = append(args, "-map", "0:v?", "-map", "0:a?")
+		for i := 1; i < inputs; i++ {
+			args = append(args, "-map", strconv.Itoa(i))
 		}
 	}
+	if AudioOnly {
+		args = append(args, "-vn", "-c:a", "copy")
+	} else {
+		args = append(args, "-c", "copy")
+	}
+	if opts.subs != "" {
+		args = append(args, "-c:s", subtitlesCodec(opts.subs), "-metadata:s:s:0", "title=Chat")
+	}
+	if coverStream {
+		args = append(args, "-disposition:v:1", "attached_pic")
+	} else if opts.cover != "" {
+		args = append(args, "-attach", opts.cover, "-metadata:s:t", "mimetype=image/jpeg", "-metadata:s:t", "filename="+filepath.Base(opts.cover))
+	}
+	for _, m := range opts.metadata {
+		args = append(args, "-metadata", m[0]+"="+m[1])
+	}
+	return append(args, "-fflags", "+genpts", "-bsf:a", "aac_adtstoasc", "-f", ffmpegFormat(), vodFile)
 }
 
-func fatalPrintf(err error, format string, opts ...interface{}) {
-	if len(format) > 0 {
-		fmt.Fprintf(os.Stderr, format, opts...)
+// ffmpegFormat returns ffmpeg muxer name of the output container
+func ffmpegFormat() string {
+	switch {
+	case AudioOnly:
+		return "ipod"
+	case Container == containerMKV:
+		return "matroska"
 	}
-	debugPrintf(format, err)
-	os.Exit(1)
+	return containerMP4
 }
 
-// GetVODInfo print only useful data about given VOD ID
-// It uses New Twitch API, so be sure that using this function is totally safe for user
-func GetVODInfo(vodID string) string {
-	var twData struct {
-		Data []struct {
-			Title       string `json:"title,omitempty"`
-			Type        string `json:"type,omitempty"`
-			ViewCount   int    `json:"view_count,omitempty"`
-			UserID      string `json:"user_id,omitempty"`
-			Duration    string `json:"duration,omitempty"`
-			CreatedAt   string `json:"created_at,omitempty"`
-			Viewable    string `json:"viewable,omitempty"`
-			Language    string `json:"language,omitempty"`
-			Description string `json:"description,omitempty"`
-		} `json:"data"`
-	}
-	done := make(chan string)
-	go printQialityOpts(vodID, done)
-	rs := newAPIGetVideo + vodID
-	req, _ := http.NewRequest("GET", rs, nil)
-	req.Header.Set("Client-ID", twitchClient)
-	var c http.Client
-	resp, err := c.Do(req)
-	if err != nil {
-		fatalPrintf(fmt.Errorf("GetVODInfo: cannot retreive VOD info via API. %s", err.Error()), "Could not retrieve data from server\n")
-		os.Exit(1)
+// outputExtension returns extension of the output file
+func outputExtension() string {
+	if p := transcodeProfiles[Transcode]; p.ext != "" {
+		return p.ext
 	}
-	dec := json.NewDecoder(resp.Body)
-	err = dec.Decode(&twData)
-	if err != nil {
-		fatalPrintf(fmt.Errorf("GetVODInfo: cannot decode data. %s", err.Error()), "Could not parse recieved data\n")
-		os.Exit(1)
+	if AudioOnly {
+		return containerM4A
 	}
-	if twData.Data[0].Description == "" {
-		twData.Data[0].Description = "Empty"
+	return Container
+}
+
+// subtitlesCodec returns codec for subtitle stream that the output container supports
+func subtitlesCodec(subs string) string {
+	if Container == containerMP4 {
+		return "mov_text"
 	}
-	t, _ := time.Parse(time.RFC3339, twData.Data[0].CreatedAt)
-	tf := fmt.Sprintf("%d/%d/%d %d:%d", t.Month(), t.Day(), t.Year(), t.Hour(), t.Minute())
-	ret := fmt.Sprintf("\nTitle: %s\nType: %s\nViews: %d\nStreamer ID: %s\nFull duration: %s\nCreated at: %s\nViewable by: %s\nVideo language: %s\nDescription: %s\n", twData.Data[0].Title, strings.Title(twData.Data[0].Type), twData.Data[0].ViewCount, twData.Data[0].UserID, twData.Data[0].Duration, tf, strings.Title(twData.Data[0].Viewable), strings.Title(twData.Data[0].Language), twData.Data[0].Description)
+	return strings.TrimPrefix(filepath.Ext(subs), ".")
+}
 
-	retQuality := fmt.Sprintf("\nAvailable quality options:\n%s", <-done)
-	return (ret + retQuality)
+// fatalConnectPrintf explains why connection to Twitch failed and exits
+func fatalConnectPrintf(err error) {
+	switch {
+	case errors.Is(err, errBadOAuthToken):
+		fatalPrintf(err, "Twitch rejected your OAuth token. Check that it is correct and not expired\n")
+	case errors.Is(err, errVODRestricted) && OAuthToken == "":
+		fatalPrintf(err, "This VOD is available only for subscribers. Provide your OAuth token with -oauth option or TTVLDR_OAUTH environment variable\n")
+	case errors.Is(err, errVODRestricted):
+		fatalPrintf(err, "This VOD is restricted and your account has no access to it\n")
+	}
+	var te *tokenError
+	if errors.As(err, &te) {
+		fatalPrintf(err, "Could not get access token from Twitch\n%s\n", te.Error())
+	}
+	fatalPrintf(err, "There was an error while connecting to Twitch server\n")
 }
 
-func printQialityOpts(vodID string, done chan<- string) {
-	pi, err := connectTwitch(vodID)
-	if err != nil {
-		fatalPrintf(err, "There was an error while connecting to Twitch server\n")
+// GetVODInfo print only useful data about given VOD ID
+// It uses New Twitch API, so be sure that using this function is totally safe for user
+func GetVODInfo(vodID string) string {
+	r := getVODReport(vodID)
+	if r.Description == "" {
+		r.Description = "Empty"
 	}
+	t := r.CreatedAt
+	tf := fmt.Sprintf("%d/%d/%d %d:%d", t.Month(), t.Day(), t.Year(), t.Hour(), t.Minute())
+	streamerURL := ""
+	if r.Streamer.ProfileURL != "" {
+		streamerURL = "\nStreamer URL: " + r.Streamer.ProfileURL
+	}
+	ret := fmt.Sprintf("\nTitle: %s\nType: %s\nViews: %d\nStreamer: %s%s\nFull duration: %s\nCreated at: %s\nViewable by: %s\nVideo language: %s\nDescription: %s\n", r.Title, strings.Title(r.Type), r.ViewCount, r.Streamer, streamerURL, r.Duration, tf, strings.Title(r.Viewable), strings.Title(r.Language), r.Description)
+
 	buf := bytes.NewBufferString("")
-	for _, q := range pi {
-		buf.WriteString(q.quality)
+	for _, q := range r.Renditions {
+		buf.WriteString(q.Quality)
 		buf.WriteString("\n")
 	}
-	done <- buf.String()
+	retQuality := fmt.Sprintf("\nAvailable quality options:\n%s", buf.String())
+	return (ret + retQuality)
 }
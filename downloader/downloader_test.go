@@ -1,7 +1,13 @@
 package downloader
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -10,38 +16,73 @@ var (
 	vodID = "309711819" //this is a HL so it's 99.99% never be deleted
 )
 
-func TestGetM3U8LinkByQiality(t *testing.T) {
-	pi := []playlistInfo{
-		{quality: "chunked", link: "http://fastly.vod.hls.ttvnw.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/chunked/highlight-309711819.m3u8"},
-		{quality: "720p60", link: "http://fastly.vod.hls.ttvnw.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/720p60/highlight-309711819.m3u8"},
-		{quality: "720p30", link: "http://fastly.vod.hls.ttvnw.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/720p30/highlight-309711819.m3u8"},
-		{quality: "480p30", link: "http://fastly.vod.hls.ttvnw.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/480p30/highlight-309711819.m3u8"},
-		{quality: "360p30", link: "http://fastly.vod.hls.ttvnw.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/360p30/highlight-309711819.m3u8"},
-		{quality: "160p30", link: "http://fastly.vod.hls.ttvnw.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/160p30/highlight-309711819.m3u8"},
+func TestGetToken(t *testing.T) {
+	sigWant := "cee2dbb02315a633a1d35f1ee62c83742fd28fe6"
+	_, sig, err := getToken(vodID)
+	if err != nil || len(sig) != len(sigWant) {
+		t.Errorf("getToken: test failed. want: %s. got: %s. err: %v", sigWant, sig, err)
 	}
+}
+
+func TestRestrictedBitrates(t *testing.T) {
 	cases := []struct {
-		input, want string
+		input string
+		want  []string
 	}{
-		{input: "chunked", want: "http://fastly.vod.hls.ttvnw.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/chunked/highlight-309711819.m3u8"},
-		{input: "720p60", want: "http://fastly.vod.hls.ttvnw.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/720p60/highlight-309711819.m3u8"},
-		{input: "720p30", want: "http://fastly.vod.hls.ttvnw.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/720p30/highlight-309711819.m3u8"},
-		{input: "480p30", want: "http://fastly.vod.hls.ttvnw.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/480p30/highlight-309711819.m3u8"},
-		{input: "360p30", want: "http://fastly.vod.hls.ttvnw.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/360p30/highlight-309711819.m3u8"},
-		{input: "160p30", want: "http://fastly.vod.hls.ttvnw.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/160p30/highlight-309711819.m3u8"},
+		{input: `{"user_id":null,"vod_id":309711819,"chansub":{"restricted_bitrates":[]}}`, want: nil},
+		{input: `{"user_id":1,"vod_id":309711819,"chansub":{"restricted_bitrates":["chunked","720p60"]}}`, want: []string{"chunked", "720p60"}},
+		{input: `not a json`, want: nil},
 	}
 	for _, c := range cases {
-		got := getM3U8LinkByQiality(pi, c.input)
-		if got != c.want {
-			t.Errorf("getM3U8LinkByQiality: test failed. got: %s. want: %s", got, c.want)
+		got := restrictedBitrates(c.input)
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("restrictedBitrates: test failed. got: %v. want: %v", got, c.want)
 		}
 	}
 }
 
-func TestGetToken(t *testing.T) {
-	sigWant := "cee2dbb02315a633a1d35f1ee62c83742fd28fe6"
-	_, sig, err := getToken(vodID)
-	if err != nil || len(sig) != len(sigWant) {
-		t.Errorf("getToken: test failed. want: %s. got: %s. err: %v", sigWant, sig, err)
+func TestSaveSegment(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/short.ts" {
+			w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+			w.Write(data[:len(data)/2])
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "ttvldr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		link    string
+		wantErr bool
+	}{
+		{link: srv.URL + "/0.ts", wantErr: false},
+		{link: srv.URL + "/short.ts", wantErr: true},
+	}
+	for i, c := range cases {
+		file := filepath.Join(dir, fmt.Sprintf("%d.ts", i))
+		resp, err := segmentGet(c.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = saveSegment(resp, segment{uri: c.link}, file)
+		resp.Body.Close()
+		if (err != nil) != c.wantErr {
+			t.Errorf("saveSegment: test failed for %s. got err: %v. want err: %v", c.link, err, c.wantErr)
+		}
+		if _, err := os.Stat(file + partExtension); !os.IsNotExist(err) {
+			t.Errorf("saveSegment: test failed for %s. temporary file was left", c.link)
+		}
+		got, err := ioutil.ReadFile(file)
+		if c.wantErr != os.IsNotExist(err) || (!c.wantErr && !bytes.Equal(got, data)) {
+			t.Errorf("saveSegment: test failed for %s. got %d bytes. err: %v", c.link, len(got), err)
+		}
 	}
 }
 
@@ -77,7 +118,8 @@ func ExampleGetVODInfo() {
 	// Title: Keep On Rolling Rolling Rolling
 	// Type: Highlight
 	// Views: 19
-	// Streamer ID: 116245074
+	// Streamer: baggins_tv
+	// Streamer URL: https://www.twitch.tv/baggins_tv
 	// Full duration: 17m14s
 	// Created at: 9/13/2018 21:47
 	// Viewable by: Public
@@ -93,3 +135,31 @@ func ExampleGetVODInfo() {
 	// 160p30
 
 }
+
+func TestCleanupTemp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ttvldr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// two jobs are running and the second one has finished
+	paths := []string{filepath.Join(dir, "job1_tmp"), filepath.Join(dir, "job1.mp4.part"), filepath.Join(dir, "job2_tmp")}
+	for _, p := range paths {
+		if err = os.MkdirAll(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addTemp(paths[0], paths[1])
+	addTemp(paths[2])
+	releaseTemp(paths[2])
+	cleanupTemp()
+	for i, p := range paths {
+		_, err := os.Stat(p)
+		if removed := os.IsNotExist(err); removed != (i < 2) {
+			t.Errorf("cleanupTemp: test failed for %s. got removed: %v. want: %v", p, removed, i < 2)
+		}
+	}
+	if len(tempFiles.paths) != 0 {
+		t.Errorf("cleanupTemp: test failed. got %d registered paths. want: 0", len(tempFiles.paths))
+	}
+}
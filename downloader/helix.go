@@ -0,0 +1,138 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/zerospiel/ttvldr/internal/helix"
+)
+
+// appTokenMargin is how long before expiry an app token is considered expired
+const appTokenMargin = time.Minute
+
+var (
+	// HelixClientID is Client-ID of the application registered in Twitch developer console
+	HelixClientID = twitchClient
+	// HelixClientSecret is the secret of HelixClientID. If set, Helix API requests use app access token
+	HelixClientSecret string
+
+	// helixBaseURL, appTokenURL and appTokenCacheDir are variables for tests
+	helixBaseURL     = helix.BaseURL
+	appTokenURL      = helix.TokenURL
+	appTokenCacheDir = os.UserCacheDir
+
+	appTokens = struct {
+		sync.Mutex
+		token *appToken
+	}{}
+)
+
+// appToken is an app access token of the client credentials flow
+type appToken struct {
+	ClientID    string    `json:"client_id"`
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func (t *appToken) valid() bool {
+	return t != nil && t.ClientID == HelixClientID && t.AccessToken != "" && time.Now().Add(appTokenMargin).Before(t.ExpiresAt)
+}
+
+// helixDoer sends Helix requests with the package client, user defined User-Agent and request timeout.
+// Headers and Cookies are meant for media hosts, so they must not replace Client-ID and the token
+// or reach Twitch with the client secret
+type helixDoer struct{}
+
+func (helixDoer) Do(req *http.Request) (*http.Response, error) {
+	setUserAgent(req)
+	return doRequest(req, HTTP.RequestTimeout)
+}
+
+// newHelixClient returns Helix API client. With HelixClientSecret it authorizes with app access token
+func newHelixClient() *helix.Client {
+	c := helix.NewClient(HelixClientID)
+	c.HTTP = helixDoer{}
+	c.BaseURL, c.TokenURL = helixBaseURL, appTokenURL
+	if HelixClientSecret != "" {
+		c.Token = func(ctx context.Context, refresh bool) (string, error) {
+			return getAppToken(ctx, c, refresh)
+		}
+	}
+	return c
+}
+
+// getAppToken returns cached app access token or requests a new one if it's expired or refresh is set
+func getAppToken(ctx context.Context, c *helix.Client, refresh bool) (string, error) {
+	appTokens.Lock()
+	defer appTokens.Unlock()
+	if !refresh {
+		if !appTokens.token.valid() {
+			appTokens.token = readAppToken()
+		}
+		if appTokens.token.valid() {
+			return appTokens.token.AccessToken, nil
+		}
+	} else {
+		logger.Info("Helix API rejected app access token, requesting a new one")
+	}
+	at, err := c.RequestAppToken(ctx, HelixClientSecret)
+	if err != nil {
+		return "", fmt.Errorf("getAppToken: %w", err)
+	}
+	logger.Debug("got app access token", "expires_in", at.ExpiresIn)
+	t := &appToken{
+		ClientID:    HelixClientID,
+		AccessToken: at.AccessToken,
+		ExpiresAt:   time.Now().Add(at.ExpiresIn),
+	}
+	appTokens.token = t
+	writeAppToken(t)
+	return t.AccessToken, nil
+}
+
+// appTokenFile is where app access token is kept between runs
+func appTokenFile() (string, error) {
+	dir, err := appTokenCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ttvldr", "app_token.json"), nil
+}
+
+func readAppToken() *appToken {
+	file, err := appTokenFile()
+	if err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	t := &appToken{}
+	if err = json.Unmarshal(data, t); err != nil {
+		logger.Debug("ignoring broken app token cache", "file", file, "err", err)
+		return nil
+	}
+	return t
+}
+
+func writeAppToken(t *appToken) {
+	file, err := appTokenFile()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(file), 0700)
+	}
+	if err == nil {
+		data, _ := json.Marshal(t)
+		err = ioutil.WriteFile(file, data, 0600)
+	}
+	if err != nil {
+		logger.Debug("could not cache app token", "err", err)
+	}
+}
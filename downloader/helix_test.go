@@ -0,0 +1,128 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zerospiel/ttvldr/internal/helix"
+)
+
+func TestGetVODInfo(t *testing.T) {
+	defer func(id, secret, baseURL, tokenURL string, cacheDir func() (string, error)) {
+		HelixClientID, HelixClientSecret, helixBaseURL, appTokenURL, appTokenCacheDir = id, secret, baseURL, tokenURL, cacheDir
+		appTokens.token = nil
+	}(HelixClientID, HelixClientSecret, helixBaseURL, appTokenURL, appTokenCacheDir)
+	dir := t.TempDir()
+	appTokenCacheDir = func() (string, error) { return dir, nil }
+	appTokens.token = nil
+
+	var issued int32
+	valid := "token1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/token":
+			r.ParseForm()
+			if r.Form.Get("client_secret") != "secret" || r.Form.Get("grant_type") != "client_credentials" {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"status":403,"message":"invalid client secret"}`)
+				return
+			}
+			n := atomic.AddInt32(&issued, 1)
+			fmt.Fprintf(w, `{"access_token":"token%d","expires_in":3600,"token_type":"bearer"}`, n)
+		case "/helix/videos":
+			if r.Header.Get("Client-ID") != "client" {
+				t.Errorf("getVODInfo: test failed. got Client-ID: %s", r.Header.Get("Client-ID"))
+			}
+			if r.Header.Get("Authorization") != "Bearer "+valid {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error":"Unauthorized","status":401,"message":"Invalid OAuth token"}`)
+				return
+			}
+			if r.FormValue("id") != "1" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, `{"data":[{"id":"1","title":"foo"}]}`)
+		}
+	}))
+	defer srv.Close()
+	helixBaseURL, appTokenURL = srv.URL+"/helix", srv.URL+"/oauth2/token"
+	HelixClientID = "client"
+
+	HelixClientSecret = ""
+	if _, err := getVODInfo("1"); !errors.Is(err, helix.ErrUnauthorized) || !strings.Contains(err.Error(), "Invalid OAuth token") {
+		t.Errorf("getVODInfo: test failed without secret. got: %v. want: %v with Helix message", err, helix.ErrUnauthorized)
+	}
+
+	HelixClientSecret = "secret"
+	vi, err := getVODInfo("1")
+	if err != nil || vi.Title != "foo" || vi.URL != twitchVideoURL+"1" {
+		t.Errorf("getVODInfo: test failed. got: %+v, %v", vi, err)
+	}
+	if _, err = getVODInfo("2"); err == nil || err.Error() != "getVODInfo: no VOD with ID 2" {
+		t.Errorf("getVODInfo: test failed for unknown VOD. got: %v", err)
+	}
+	// cached token is used by the next run
+	appTokens.token = nil
+	if _, err = getVODInfo("1"); err != nil || issued != 1 {
+		t.Errorf("getVODInfo: test failed. cached token was not used. issued: %d, err: %v", issued, err)
+	}
+	// revoked token is refreshed once
+	valid = "token2"
+	if _, err = getVODInfo("1"); err != nil || issued != 2 {
+		t.Errorf("getVODInfo: test failed. token was not refreshed. issued: %d, err: %v", issued, err)
+	}
+	// expired token is not used
+	appTokens.token.ExpiresAt = time.Now()
+	writeAppToken(appTokens.token)
+	valid = "token3"
+	if _, err = getVODInfo("1"); err != nil || issued != 3 {
+		t.Errorf("getVODInfo: test failed. expired token was used. issued: %d, err: %v", issued, err)
+	}
+
+	appTokens.token = nil
+	writeAppToken(&appToken{})
+	HelixClientSecret = "wrong"
+	if _, err = getVODInfo("1"); err == nil || !strings.Contains(err.Error(), "invalid client secret") {
+		t.Errorf("getVODInfo: test failed with wrong secret. got: %v", err)
+	}
+}
+
+func TestHelixUserHeaders(t *testing.T) {
+	defer func(secret, baseURL, tokenURL string, cacheDir func() (string, error), h http.Header, c string) {
+		HelixClientSecret, helixBaseURL, appTokenURL, appTokenCacheDir, Headers, Cookies = secret, baseURL, tokenURL, cacheDir, h, c
+		appTokens.token = nil
+	}(HelixClientSecret, helixBaseURL, appTokenURL, appTokenCacheDir, Headers, Cookies)
+	dir := t.TempDir()
+	appTokenCacheDir = func() (string, error) { return dir, nil }
+	appTokens.token = nil
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c := r.Header.Get("Cookie"); c != "" {
+			t.Errorf("helixDoer: test failed. %s got cookies: %s", r.URL.Path, c)
+		}
+		switch r.URL.Path {
+		case "/oauth2/token":
+			fmt.Fprint(w, `{"access_token":"token","expires_in":3600,"token_type":"bearer"}`)
+		case "/helix/videos":
+			if got := r.Header.Get("Authorization"); got != "Bearer token" {
+				t.Errorf("helixDoer: test failed. got Authorization: %s. want: Bearer token", got)
+			}
+			fmt.Fprint(w, `{"data":[{"id":"1","title":"foo"}]}`)
+		}
+	}))
+	defer srv.Close()
+	helixBaseURL, appTokenURL = srv.URL+"/helix", srv.URL+"/oauth2/token"
+	HelixClientSecret = "secret"
+	Headers = http.Header{"Authorization": {"Basic bWVkaWE6aG9zdA=="}}
+	Cookies = "session=abc"
+	if _, err := getVODInfo("1"); err != nil {
+		t.Errorf("getVODInfo: test failed. got an error: %s", err.Error())
+	}
+}
@@ -0,0 +1,463 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	hlsStreamInf      = "#EXT-X-STREAM-INF:"
+	hlsInf            = "#EXTINF:"
+	hlsTargetDuration = "#EXT-X-TARGETDURATION:"
+	hlsMediaSequence  = "#EXT-X-MEDIA-SEQUENCE:"
+	hlsByteRange      = "#EXT-X-BYTERANGE:"
+	hlsMap            = "#EXT-X-MAP:"
+)
+
+// variant is a single rendition listed in a master playlist
+type variant struct {
+	uri        string
+	name       string
+	bandwidth  int
+	resolution string
+	frameRate  float64
+	codecs     string
+}
+
+// segment is a single media segment listed in a media playlist
+type segment struct {
+	uri      string
+	duration float64
+	sequence int
+	key      *segmentKey
+	// byteRange is set if the segment is a part of the resource at uri
+	byteRange *byteRange
+	// init is set for segments like fMP4 which can't be played without a media initialization section
+	init *mediaInit
+}
+
+// byteRange is a part of a resource set by #EXT-X-BYTERANGE or BYTERANGE attribute of #EXT-X-MAP
+type byteRange struct {
+	offset, length int64
+}
+
+// header returns value of Range request header
+func (br byteRange) header() string {
+	return fmt.Sprintf("bytes=%d-%d", br.offset, br.offset+br.length-1)
+}
+
+// mediaInit is a media initialization section set by #EXT-X-MAP, e.g. ftyp and moov boxes of fMP4.
+// It's written before every segment, so each of them is a complete file for ffmpeg concat
+type mediaInit struct {
+	uri       string
+	byteRange *byteRange
+}
+
+// parseByteRange parses <length>[@<offset>]. Offset is -1 if it's absent
+func parseByteRange(s string) (*byteRange, error) {
+	br := &byteRange{offset: -1}
+	var err error
+	if i := strings.Index(s, "@"); i >= 0 {
+		if br.offset, err = strconv.ParseInt(s[i+1:], 10, 64); err != nil || br.offset < 0 {
+			return nil, fmt.Errorf("parseByteRange: wrong offset in %s", s)
+		}
+		s = s[:i]
+	}
+	if br.length, err = strconv.ParseInt(s, 10, 64); err != nil || br.length <= 0 {
+		return nil, fmt.Errorf("parseByteRange: wrong length in %s", s)
+	}
+	return br, nil
+}
+
+type mediaPlaylist struct {
+	targetDuration int
+	mediaSequence  int
+	segments       []segment
+}
+
+func (mp *mediaPlaylist) durations() []float64 {
+	d := make([]float64, 0, len(mp.segments))
+	for _, s := range mp.segments {
+		d = append(d, s.duration)
+	}
+	return d
+}
+
+// fetchPlaylist downloads a playlist and returns its final location to resolve relative URIs against
+func fetchPlaylist(link string) (*url.URL, []byte, error) {
+	resp, err := playlistGet(link)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetchPlaylist: cannot retrieve given m3u8 list. %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("fetchPlaylist: server responded with %d code", resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetchPlaylist: cannot read list data. %s", err.Error())
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("#EXTM3U")) {
+		return nil, nil, errors.New("fetchPlaylist: response is not an m3u8 list")
+	}
+	return resp.Request.URL, data, nil
+}
+
+func isMasterPlaylist(data []byte) bool {
+	return bytes.Contains(data, []byte(hlsStreamInf))
+}
+
+// parseMasterPlaylist returns variants of a master playlist with absolute URIs
+func parseMasterPlaylist(base *url.URL, data []byte) ([]variant, error) {
+	var vs []variant
+	var cur *variant
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, hlsStreamInf):
+			attrs := parseAttributes(line[len(hlsStreamInf):])
+			cur = &variant{
+				name:       attrs["VIDEO"],
+				resolution: attrs["RESOLUTION"],
+				codecs:     attrs["CODECS"],
+			}
+			cur.bandwidth, _ = strconv.Atoi(attrs["BANDWIDTH"])
+			cur.frameRate, _ = strconv.ParseFloat(attrs["FRAME-RATE"], 64)
+		case line == "" || strings.HasPrefix(line, "#"):
+		case cur != nil:
+			u, err := resolveURI(base, line)
+			if err != nil {
+				return nil, fmt.Errorf("parseMasterPlaylist: %s", err.Error())
+			}
+			cur.uri = u
+			if cur.name == "" {
+				cur.name = variantName(cur)
+			}
+			vs = append(vs, *cur)
+			cur = nil
+		}
+	}
+	if len(vs) == 0 {
+		return nil, errors.New("parseMasterPlaylist: no variants in the list")
+	}
+	return vs, nil
+}
+
+// variantName makes a Twitch-like quality name for variants without VIDEO group, e.g. 720p30
+func variantName(v *variant) string {
+	if i := strings.Index(v.resolution, "x"); i >= 0 {
+		name := v.resolution[i+1:] + "p"
+		if v.frameRate > 0 {
+			name += strconv.Itoa(int(v.frameRate + .5))
+		}
+		return name
+	}
+	if v.bandwidth > 0 {
+		return strconv.Itoa(v.bandwidth/1000) + "k"
+	}
+	return path.Base(v.uri)
+}
+
+// parseMediaPlaylist returns segments of a media playlist with absolute URIs
+func parseMediaPlaylist(base *url.URL, data []byte) (*mediaPlaylist, error) {
+	mp := &mediaPlaylist{}
+	duration := -1.
+	var key *segmentKey
+	var init *mediaInit
+	// br is the range of the next segment. A range without offset follows the previous one of the same URI
+	var br *byteRange
+	prevURI, prevEnd := "", int64(0)
+	resolve := func(ref string) (string, error) {
+		return resolveURI(base, ref)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, hlsTargetDuration):
+			td, err := strconv.Atoi(line[len(hlsTargetDuration):])
+			if err != nil {
+				return nil, fmt.Errorf("parseMediaPlaylist: cannot cast TARGETDURATION to type int. %s", err.Error())
+			}
+			mp.targetDuration = td
+		case strings.HasPrefix(line, hlsMediaSequence):
+			ms, err := strconv.Atoi(line[len(hlsMediaSequence):])
+			if err != nil {
+				return nil, fmt.Errorf("parseMediaPlaylist: cannot cast MEDIA-SEQUENCE to type int. %s", err.Error())
+			}
+			mp.mediaSequence = ms
+		case strings.HasPrefix(line, hlsKey):
+			var err error
+			key, err = parseKey(parseAttributes(line[len(hlsKey):]), resolve)
+			if err != nil {
+				return nil, fmt.Errorf("parseMediaPlaylist: %s", err.Error())
+			}
+		case strings.HasPrefix(line, hlsByteRange):
+			var err error
+			if br, err = parseByteRange(strings.TrimSpace(line[len(hlsByteRange):])); err != nil {
+				return nil, fmt.Errorf("parseMediaPlaylist: %s", err.Error())
+			}
+		case strings.HasPrefix(line, hlsMap):
+			var err error
+			if init, err = parseMap(parseAttributes(line[len(hlsMap):]), resolve); err != nil {
+				return nil, fmt.Errorf("parseMediaPlaylist: %s", err.Error())
+			}
+			// the section is written unencrypted before decrypted segments
+			if key != nil {
+				return nil, fmt.Errorf("parseMediaPlaylist: encrypted media initialization section %s is not supported", init.uri)
+			}
+		case strings.HasPrefix(line, hlsInf):
+			d := line[len(hlsInf):]
+			if i := strings.Index(d, ","); i >= 0 {
+				d = d[:i]
+			}
+			var err error
+			duration, err = strconv.ParseFloat(d, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parseMediaPlaylist: cannot parse duration as float64. %s", err.Error())
+			}
+		case line == "" || strings.HasPrefix(line, "#"):
+		case duration >= 0:
+			u, err := resolveURI(base, line)
+			if err != nil {
+				return nil, fmt.Errorf("parseMediaPlaylist: %s", err.Error())
+			}
+			if br != nil && br.offset < 0 {
+				if u != prevURI {
+					return nil, fmt.Errorf("parseMediaPlaylist: no offset of byte range of %s", u)
+				}
+				br.offset = prevEnd
+			}
+			prevURI, prevEnd = "", 0
+			if br != nil {
+				prevURI, prevEnd = u, br.offset+br.length
+			}
+			mp.segments = append(mp.segments, segment{
+				uri:       u,
+				duration:  duration,
+				sequence:  mp.mediaSequence + len(mp.segments),
+				key:       key,
+				byteRange: br,
+				init:      init,
+			})
+			duration, br = -1, nil
+		}
+	}
+	if len(mp.segments) == 0 {
+		return nil, errors.New("parseMediaPlaylist: no segments in the list")
+	}
+	return mp, nil
+}
+
+// initEntry is a media initialization section that is fetched once. done is closed when data or err is set
+type initEntry struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+var initCache = struct {
+	sync.Mutex
+	sections map[string]*initEntry
+}{sections: make(map[string]*initEntry)}
+
+// fetchInit downloads a media initialization section once and keeps it for other segments.
+// Failed requests are not cached
+func fetchInit(init *mediaInit) ([]byte, error) {
+	id := init.uri
+	if init.byteRange != nil {
+		id += " " + init.byteRange.header()
+	}
+	initCache.Lock()
+	e, ok := initCache.sections[id]
+	if !ok {
+		e = &initEntry{done: make(chan struct{})}
+		initCache.sections[id] = e
+	}
+	initCache.Unlock()
+	if ok {
+		<-e.done
+		return e.data, e.err
+	}
+	e.data, e.err = requestInit(init)
+	if e.err != nil {
+		initCache.Lock()
+		delete(initCache.sections, id)
+		initCache.Unlock()
+	}
+	close(e.done)
+	return e.data, e.err
+}
+
+func requestInit(init *mediaInit) ([]byte, error) {
+	resp, err := segmentRangeGet(init.uri, init.byteRange)
+	if err != nil {
+		return nil, fmt.Errorf("fetchInit: cannot retrieve media initialization section. %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != rangeStatus(init.byteRange) {
+		return nil, fmt.Errorf("fetchInit: server responded with %d code", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("fetchInit: cannot read media initialization section. %s", err.Error())
+	}
+	return data, nil
+}
+
+// rangeStatus returns successful response status of a request for br. A server that ignores
+// Range header responds with 200 and the whole resource, which is an error for a byte range
+func rangeStatus(br *byteRange) int {
+	if br != nil {
+		return http.StatusPartialContent
+	}
+	return http.StatusOK
+}
+
+// parseMap parses attributes of #EXT-X-MAP tag
+func parseMap(attrs map[string]string, resolve func(string) (string, error)) (*mediaInit, error) {
+	if attrs["URI"] == "" {
+		return nil, errors.New("parseMap: no URI")
+	}
+	uri, err := resolve(attrs["URI"])
+	if err != nil {
+		return nil, fmt.Errorf("parseMap: %s", err.Error())
+	}
+	init := &mediaInit{uri: uri}
+	if attrs["BYTERANGE"] != "" {
+		if init.byteRange, err = parseByteRange(attrs["BYTERANGE"]); err != nil {
+			return nil, fmt.Errorf("parseMap: %s", err.Error())
+		}
+		if init.byteRange.offset < 0 {
+			init.byteRange.offset = 0
+		}
+	}
+	return init, nil
+}
+
+// parseAttributes parses attribute list like BANDWIDTH=100,CODECS="avc1,mp4a"
+func parseAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for s != "" {
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+		var val string
+		if strings.HasPrefix(s, "\"") {
+			end := strings.Index(s[1:], "\"")
+			if end < 0 {
+				end = len(s) - 1
+			}
+			val, s = s[1:end+1], s[end+1:]
+			if c := strings.Index(s, ","); c >= 0 {
+				s = s[c+1:]
+			} else {
+				s = ""
+			}
+		} else if c := strings.Index(s, ","); c >= 0 {
+			val, s = strings.TrimSpace(s[:c]), s[c+1:]
+		} else {
+			val, s = strings.TrimSpace(s), ""
+		}
+		attrs[key] = val
+	}
+	return attrs
+}
+
+func resolveURI(base *url.URL, ref string) (string, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse URI %s. %s", ref, err.Error())
+	}
+	return base.ResolveReference(u).String(), nil
+}
+
+// DownloadHLS download video from any HLS master or media playlist URL from start time to end time.
+// Selector chooses a variant of a master playlist:
+// "best" or empty for the highest bandwidth, "worst" for the lowest,
+// resolution like "1280x720" or maximum bandwidth in bits per second like "3000000", "3000k" or "3M".
+// It returns an error wrapping ErrNoQuality if no variant matches, other failures exit the program
+func DownloadHLS(link string, start string, end string, selector string) error {
+	err := downloadPlaylist(link, start, end, func(vs []variant) (string, error) {
+		if AudioOnly {
+			return chooseQuality(vs, "")
+		}
+		v, err := selectVariant(vs, selector)
+		if err != nil {
+			return "", fmt.Errorf("%w %s. %s", ErrNoQuality, selector, err.Error())
+		}
+		fmt.Printf("Downloading variant %s (%s, %d bits/s)...\n", v.name, v.resolution, v.bandwidth)
+		return v.uri, nil
+	})
+	if err != nil {
+		return fmt.Errorf("DownloadHLS: %w", err)
+	}
+	return nil
+}
+
+// selectVariant chooses a variant by bandwidth or resolution, see DownloadHLS
+func selectVariant(vs []variant, selector string) (variant, error) {
+	if len(vs) == 0 {
+		return variant{}, errors.New("selectVariant: no variants")
+	}
+	sorted := make([]variant, len(vs))
+	copy(sorted, vs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].bandwidth < sorted[j].bandwidth
+	})
+	selector = strings.TrimSpace(selector)
+	switch {
+	case selector == "" || selector == "best":
+		return sorted[len(sorted)-1], nil
+	case selector == "worst":
+		return sorted[0], nil
+	case strings.Contains(selector, "x"):
+		for i := len(sorted) - 1; i >= 0; i-- {
+			if sorted[i].resolution == selector {
+				return sorted[i], nil
+			}
+		}
+		return variant{}, fmt.Errorf("selectVariant: no variant with resolution %s", selector)
+	}
+	maxBandwidth, err := parseBandwidth(selector)
+	if err != nil {
+		return variant{}, fmt.Errorf("selectVariant: unknown selector %s. %s", selector, err.Error())
+	}
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if sorted[i].bandwidth <= maxBandwidth {
+			return sorted[i], nil
+		}
+	}
+	return variant{}, fmt.Errorf("selectVariant: no variant with bandwidth up to %d", maxBandwidth)
+}
+
+// parseBandwidth parses numbers like 3000000, 3000k or 3M
+func parseBandwidth(s string) (int, error) {
+	mult := 1
+	switch {
+	case strings.HasSuffix(s, "k") || strings.HasSuffix(s, "K"):
+		mult, s = 1000, s[:len(s)-1]
+	case strings.HasSuffix(s, "m") || strings.HasSuffix(s, "M"):
+		mult, s = 1000000, s[:len(s)-1]
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("parseBandwidth: wrong number %s", s)
+	}
+	return int(f * float64(mult)), nil
+}
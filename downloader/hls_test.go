@@ -0,0 +1,263 @@
+package downloader
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testMasterPlaylist = `#EXTM3U
+#EXT-X-TWITCH-INFO:ORIGIN="s3",B="false",REGION="EU",USER-IP="127.0.0.1",SERVING-ID="a",CLUSTER="cloudfront_vod",USER-COUNTRY="NL",MANIFEST-CLUSTER="cloudfront_vod"
+#EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID="chunked",NAME="1080p60 (source)",AUTOSELECT=YES,DEFAULT=YES
+#EXT-X-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=6335149,CODECS="avc1.64002A,mp4a.40.2",RESOLUTION="1920x1080",VIDEO="chunked",FRAME-RATE=60.000
+https://d2nvs31859zcd8.cloudfront.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/chunked/highlight-309711819.m3u8
+#EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID="720p30",NAME="720p",AUTOSELECT=YES,DEFAULT=YES
+#EXT-X-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=2373000,CODECS="avc1.4D401F,mp4a.40.2",RESOLUTION="1280x720",VIDEO="720p30",FRAME-RATE=30.000
+720p30/highlight-309711819.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=160000,CODECS="mp4a.40.2"
+/audio/index.m3u8
+`
+	testMediaPlaylist = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:10
+#ID3-EQUIV-TDTG:2018-09-13T21:47:11
+#EXT-X-PLAYLIST-TYPE:EVENT
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-TWITCH-ELAPSED-SECS:0.000
+#EXT-X-TWITCH-TOTAL-SECS:1034.000
+#EXTINF:10.000,
+0.ts
+#EXTINF:10.000,
+1.ts?start_offset=0
+#EXTINF:4.500,title
+https://other.host/2.ts
+#EXT-X-ENDLIST
+`
+)
+
+func TestParseMasterPlaylist(t *testing.T) {
+	base, _ := url.Parse("https://d2nvs31859zcd8.cloudfront.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/chunked/index.m3u8")
+	got, err := parseMasterPlaylist(base, []byte(testMasterPlaylist))
+	if err != nil {
+		t.Fatalf("parseMasterPlaylist: test failed. got an error: %s", err.Error())
+	}
+	want := []variant{
+		{
+			uri:        "https://d2nvs31859zcd8.cloudfront.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/chunked/highlight-309711819.m3u8",
+			name:       "chunked",
+			bandwidth:  6335149,
+			resolution: "1920x1080",
+			frameRate:  60,
+			codecs:     "avc1.64002A,mp4a.40.2",
+		},
+		{
+			uri:        "https://d2nvs31859zcd8.cloudfront.net/2268723385e60269b21f_baggins_tv_30344829920_965177301/chunked/720p30/highlight-309711819.m3u8",
+			name:       "720p30",
+			bandwidth:  2373000,
+			resolution: "1280x720",
+			frameRate:  30,
+			codecs:     "avc1.4D401F,mp4a.40.2",
+		},
+		{
+			uri:       "https://d2nvs31859zcd8.cloudfront.net/audio/index.m3u8",
+			name:      "160k",
+			bandwidth: 160000,
+			codecs:    "mp4a.40.2",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMasterPlaylist: test failed. got: %+v. want: %+v", got, want)
+	}
+	if !isMasterPlaylist([]byte(testMasterPlaylist)) || isMasterPlaylist([]byte(testMediaPlaylist)) {
+		t.Errorf("isMasterPlaylist: test failed")
+	}
+}
+
+func TestParseMediaPlaylist(t *testing.T) {
+	base, _ := url.Parse("https://d2nvs31859zcd8.cloudfront.net/vod/chunked/index-dvr.m3u8?token=abc")
+	got, err := parseMediaPlaylist(base, []byte(testMediaPlaylist))
+	if err != nil {
+		t.Fatalf("parseMediaPlaylist: test failed. got an error: %s", err.Error())
+	}
+	want := &mediaPlaylist{
+		targetDuration: 10,
+		segments: []segment{
+			{uri: "https://d2nvs31859zcd8.cloudfront.net/vod/chunked/0.ts", duration: 10},
+			{uri: "https://d2nvs31859zcd8.cloudfront.net/vod/chunked/1.ts?start_offset=0", duration: 10, sequence: 1},
+			{uri: "https://other.host/2.ts", duration: 4.5, sequence: 2},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMediaPlaylist: test failed. got: %+v. want: %+v", got, want)
+	}
+	if _, err = parseMediaPlaylist(base, []byte("#EXTM3U\n#EXT-X-ENDLIST\n")); err == nil {
+		t.Errorf("parseMediaPlaylist: test failed. want an error for empty list")
+	}
+}
+
+func TestParseMediaPlaylistByteRangeMap(t *testing.T) {
+	base, _ := url.Parse("https://cdn.example.com/vod/index.m3u8")
+	data := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:4
+#EXT-X-MAP:URI="init.mp4",BYTERANGE="720@0"
+#EXTINF:4.000,
+#EXT-X-BYTERANGE:1000@720
+video.mp4
+#EXTINF:4.000,
+#EXT-X-BYTERANGE:1200
+video.mp4
+#EXT-X-MAP:URI="init2.mp4"
+#EXTINF:2.000,
+part.m4s
+#EXT-X-ENDLIST
+`
+	got, err := parseMediaPlaylist(base, []byte(data))
+	if err != nil {
+		t.Fatalf("parseMediaPlaylist: test failed. got an error: %s", err.Error())
+	}
+	init := &mediaInit{uri: "https://cdn.example.com/vod/init.mp4", byteRange: &byteRange{offset: 0, length: 720}}
+	want := &mediaPlaylist{
+		targetDuration: 4,
+		segments: []segment{
+			{uri: "https://cdn.example.com/vod/video.mp4", duration: 4, byteRange: &byteRange{offset: 720, length: 1000}, init: init},
+			{uri: "https://cdn.example.com/vod/video.mp4", duration: 4, sequence: 1, byteRange: &byteRange{offset: 1720, length: 1200}, init: init},
+			{uri: "https://cdn.example.com/vod/part.m4s", duration: 2, sequence: 2, init: &mediaInit{uri: "https://cdn.example.com/vod/init2.mp4"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMediaPlaylist: test failed. got: %+v. want: %+v", got, want)
+	}
+	if h := got.segments[1].byteRange.header(); h != "bytes=1720-2919" {
+		t.Errorf("header: test failed. got: %s. want: bytes=1720-2919", h)
+	}
+
+	bad := []string{
+		// no offset and no previous range of the same URI
+		"#EXTM3U\n#EXTINF:4,\n#EXT-X-BYTERANGE:1000\nvideo.mp4\n",
+		"#EXTM3U\n#EXTINF:4,\n#EXT-X-BYTERANGE:abc@0\nvideo.mp4\n",
+		"#EXTM3U\n#EXT-X-MAP:BYTERANGE=\"720@0\"\n#EXTINF:4,\nvideo.mp4\n",
+		"#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"key\"\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4,\nvideo.mp4\n",
+	}
+	for _, b := range bad {
+		if _, err = parseMediaPlaylist(base, []byte(b)); err == nil {
+			t.Errorf("parseMediaPlaylist: test failed. want an error for %q", b)
+		}
+	}
+}
+
+func TestSaveSegmentByteRangeMap(t *testing.T) {
+	data := []byte("INITfirst segment|second segment")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/norange.mp4" {
+			w.Write(data)
+			return
+		}
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "ttvldr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	seg := segment{
+		uri:       srv.URL + "/video.mp4",
+		byteRange: &byteRange{offset: 18, length: 14},
+		init:      &mediaInit{uri: srv.URL + "/video.mp4", byteRange: &byteRange{offset: 0, length: 4}},
+	}
+	resp, err := segmentRangeGet(seg.uri, seg.byteRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != rangeStatus(seg.byteRange) {
+		t.Errorf("segmentRangeGet: test failed. got status: %d. want: %d", resp.StatusCode, rangeStatus(seg.byteRange))
+	}
+	file := filepath.Join(dir, "0.ts")
+	err = saveSegment(resp, seg, file)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("saveSegment: test failed. got an error: %s", err.Error())
+	}
+	if got, _ := ioutil.ReadFile(file); string(got) != "INITsecond segment" {
+		t.Errorf("saveSegment: test failed. got: %q. want: %q", got, "INITsecond segment")
+	}
+
+	// a server which ignores Range header returns the whole file
+	if _, err = fetchInit(&mediaInit{uri: srv.URL + "/norange.mp4", byteRange: &byteRange{length: 4}}); err == nil {
+		t.Errorf("fetchInit: test failed. want an error for ignored Range header")
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	got := parseAttributes(`BANDWIDTH=2373000,CODECS="avc1.4D401F,mp4a.40.2",RESOLUTION=1280x720,VIDEO="720p30"`)
+	want := map[string]string{
+		"BANDWIDTH":  "2373000",
+		"CODECS":     "avc1.4D401F,mp4a.40.2",
+		"RESOLUTION": "1280x720",
+		"VIDEO":      "720p30",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAttributes: test failed. got: %v. want: %v", got, want)
+	}
+}
+
+func TestPlaylistName(t *testing.T) {
+	cases := []struct {
+		input, prefix string
+	}{
+		{input: "https://d2nvs31859zcd8.cloudfront.net/vod/chunked/index-dvr.m3u8?token=abc", prefix: "index-dvr_"},
+		{input: "https://example.com/", prefix: "playlist_"},
+	}
+	for _, c := range cases {
+		if got := playlistName(c.input); !strings.HasPrefix(got, c.prefix) {
+			t.Errorf("playlistName: test failed. got: %s. want prefix: %s", got, c.prefix)
+		}
+	}
+}
+
+func TestSelectVariant(t *testing.T) {
+	vs := []variant{
+		{name: "720p30", bandwidth: 2373000, resolution: "1280x720"},
+		{name: "chunked", bandwidth: 6335149, resolution: "1920x1080"},
+		{name: "160p30", bandwidth: 288000, resolution: "284x160"},
+		{name: "480p30", bandwidth: 1427000, resolution: "852x480"},
+	}
+	cases := []struct {
+		selector string
+		want     string
+	}{
+		{selector: "", want: "chunked"},
+		{selector: "best", want: "chunked"},
+		{selector: "worst", want: "160p30"},
+		{selector: "852x480", want: "480p30"},
+		{selector: "3M", want: "720p30"},
+		{selector: "1500k", want: "480p30"},
+		{selector: "6335149", want: "chunked"},
+		{selector: "640x360", want: ""},
+		{selector: "100k", want: ""},
+		{selector: "foo", want: ""},
+	}
+	for _, c := range cases {
+		got, err := selectVariant(vs, c.selector)
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("selectVariant: test failed. want an error for %s. got: %v", c.selector, got)
+			}
+			continue
+		}
+		if err != nil || got.name != c.want {
+			t.Errorf("selectVariant: test failed for %s. got: %s. want: %s. err: %v", c.selector, got.name, c.want, err)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job events hooks run on
+const (
+	HookStarted  = "started"
+	HookFinished = "finished"
+	HookFailed   = "failed"
+)
+
+// HookOptions configure hooks which run on job events. Either of Command and URL or both may be set
+type HookOptions struct {
+	// Command is run by the shell with event in TTVLDR_HOOK_* environment variables
+	Command string
+	// URL gets event as JSON with POST request
+	URL string
+	// Events hooks run on. Empty means all of them
+	Events []string
+	// Timeout limits a single run of the command or a single request. 0 means no timeout
+	Timeout time.Duration
+	// Retries is how many times a failed hook is run again
+	Retries int
+}
+
+var (
+	// Hooks are options of hooks in use. Change them with ConfigureHooks
+	Hooks = HookOptions{
+		Timeout: time.Minute,
+		Retries: 2,
+	}
+
+	// hookRetryDelay is multiplied by the number of the attempt. It's a variable for tests
+	hookRetryDelay = time.Second
+
+	activeJobs = struct {
+		sync.Mutex
+		jobs map[*hookJob]struct{}
+	}{jobs: map[*hookJob]struct{}{}}
+)
+
+// ConfigureHooks checks and applies hook options
+func ConfigureHooks(opts HookOptions) error {
+	for _, e := range opts.Events {
+		if e != HookStarted && e != HookFinished && e != HookFailed {
+			return fmt.Errorf("ConfigureHooks: unknown event %s. Use %s, %s or %s", e, HookStarted, HookFinished, HookFailed)
+		}
+	}
+	if opts.URL != "" {
+		u, err := url.Parse(opts.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("ConfigureHooks: hook URL must be http:// or https:// URL")
+		}
+	}
+	if opts.Retries < 0 {
+		return fmt.Errorf("ConfigureHooks: negative number of retries %d", opts.Retries)
+	}
+	Hooks = opts
+	return nil
+}
+
+// hookEvent is the JSON payload of webhooks. Command hooks get the same fields in environment variables
+type hookEvent struct {
+	Event   string `json:"event"`
+	Job     string `json:"job"`
+	VODID   string `json:"vod_id,omitempty"`
+	Quality string `json:"quality"`
+	Output  string `json:"output"`
+	// Size of the output file in bytes, set when the job is finished
+	Size int64 `json:"size"`
+	// Duration of the downloaded part in seconds
+	Duration float64 `json:"duration"`
+	// Elapsed is time since the job was started in seconds
+	Elapsed float64   `json:"elapsed"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+func (e hookEvent) env() []string {
+	return []string{
+		"TTVLDR_HOOK_EVENT=" + e.Event,
+		"TTVLDR_HOOK_JOB=" + e.Job,
+		"TTVLDR_HOOK_VOD_ID=" + e.VODID,
+		"TTVLDR_HOOK_QUALITY=" + e.Quality,
+		"TTVLDR_HOOK_OUTPUT=" + e.Output,
+		"TTVLDR_HOOK_SIZE=" + strconv.FormatInt(e.Size, 10),
+		"TTVLDR_HOOK_DURATION=" + strconv.FormatFloat(e.Duration, 'f', 3, 64),
+		"TTVLDR_HOOK_ELAPSED=" + strconv.FormatFloat(e.Elapsed, 'f', 3, 64),
+		"TTVLDR_HOOK_ERROR=" + e.Error,
+	}
+}
+
+// hookJob is a download which hooks are run for
+type hookJob struct {
+	event   hookEvent
+	started time.Time
+}
+
+// startJob registers the job, so it fails if the program exits, and runs started hooks
+func startJob(name, vodID, quality, output string, duration float64) *hookJob {
+	j := &hookJob{
+		event: hookEvent{
+			Job:      name,
+			VODID:    vodID,
+			Quality:  quality,
+			Output:   output,
+			Duration: duration,
+		},
+		started: time.Now(),
+	}
+	activeJobs.Lock()
+	activeJobs.jobs[j] = struct{}{}
+	activeJobs.Unlock()
+	j.run(HookStarted, nil)
+	return j
+}
+
+// done unregisters the job and reports whether it was still active
+func (j *hookJob) done() bool {
+	activeJobs.Lock()
+	defer activeJobs.Unlock()
+	_, ok := activeJobs.jobs[j]
+	delete(activeJobs.jobs, j)
+	return ok
+}
+
+// finish runs finished hooks with the size of the output file
+func (j *hookJob) finish() {
+	if !j.done() {
+		return
+	}
+	if fi, err := os.Stat(j.event.Output); err == nil {
+		j.event.Size = fi.Size()
+	}
+	j.run(HookFinished, nil)
+}
+
+// failJobs runs failed hooks of all active jobs. It's called before the program exits with an error
+func failJobs(err error) {
+	activeJobs.Lock()
+	jobs := make([]*hookJob, 0, len(activeJobs.jobs))
+	for j := range activeJobs.jobs {
+		jobs = append(jobs, j)
+	}
+	activeJobs.Unlock()
+	for _, j := range jobs {
+		if j.done() {
+			j.run(HookFailed, err)
+		}
+	}
+}
+
+// run runs hooks of the event. Failed hooks are reported, but never stop the program
+func (j *hookJob) run(event string, err error) {
+	opts := Hooks
+	if !hookEnabled(opts, event) {
+		return
+	}
+	e := j.event
+	e.Event, e.Time = event, time.Now()
+	e.Elapsed = e.Time.Sub(j.started).Seconds()
+	if err != nil {
+		e.Error = err.Error()
+	}
+	log := logger.With("job", e.Job, "event", event)
+	if opts.Command != "" {
+		if err := retryHook(opts, func() error { return runHookCommand(opts, e) }); err != nil {
+			fmt.Fprintf(os.Stderr, "Hook command on %s event failed\n", event)
+			log.Warn("hook command failed", "err", err)
+		}
+	}
+	if opts.URL != "" {
+		if err := retryHook(opts, func() error { return postHook(opts, e) }); err != nil {
+			fmt.Fprintf(os.Stderr, "Webhook on %s event failed\n", event)
+			log.Warn("webhook failed", "err", err)
+		}
+	}
+}
+
+func hookEnabled(opts HookOptions, event string) bool {
+	if opts.Command == "" && opts.URL == "" {
+		return false
+	}
+	if len(opts.Events) == 0 {
+		return true
+	}
+	for _, e := range opts.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// retryHook runs hook until it succeeds, but no more than 1+Retries times
+func retryHook(opts HookOptions, hook func() error) error {
+	var err error
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * hookRetryDelay)
+		}
+		if err = hook(); err == nil {
+			return nil
+		}
+		logger.Debug("hook attempt failed", "attempt", attempt+1, "err", err)
+	}
+	return err
+}
+
+func hookContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// runHookCommand runs the command by the shell of the platform
+func runHookCommand(opts HookOptions, e hookEvent) error {
+	ctx, cancel := hookContext(opts.Timeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", opts.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", opts.Command)
+	}
+	cmd.Env = append(os.Environ(), e.env()...)
+	// children of the shell may keep its output open after it's killed on timeout
+	cmd.WaitDelay = time.Second
+	cmd.Stdout = os.Stdout
+	cmdErr := bytes.NewBuffer(nil)
+	cmd.Stderr = io.MultiWriter(os.Stderr, cmdErr)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("runHookCommand: %s. %s", err.Error(), strings.TrimSpace(cmdErr.String()))
+	}
+	return nil
+}
+
+// postHook sends the event as JSON. Any 2xx response is a success
+func postHook(opts HookOptions, e hookEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("postHook: cannot encode event. %s", err.Error())
+	}
+	// user headers and cookies are credentials of media hosts, the hook server must not get them
+	req, err := http.NewRequest("POST", opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("postHook: cannot create request. %s", err.Error())
+	}
+	setUserAgent(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := doRequest(req, opts.Timeout)
+	if err != nil {
+		// the error contains the URL, which may have a secret in its path
+		return fmt.Errorf("postHook: cannot send event to %s. %s", req.URL.Host, strings.Replace(err.Error(), opts.URL, req.URL.Host, -1))
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("postHook: server responded with %d code", resp.StatusCode)
+	}
+	return nil
+}
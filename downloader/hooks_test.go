@@ -0,0 +1,136 @@
+package downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigureHooks(t *testing.T) {
+	defer func(h HookOptions) { Hooks = h }(Hooks)
+	cases := []struct {
+		opts    HookOptions
+		wantErr bool
+	}{
+		{opts: HookOptions{Command: "true", Events: []string{HookStarted, HookFailed}}},
+		{opts: HookOptions{URL: "https://example.com/hook"}},
+		{opts: HookOptions{URL: "example.com/hook"}, wantErr: true},
+		{opts: HookOptions{Command: "true", Events: []string{"done"}}, wantErr: true},
+		{opts: HookOptions{Command: "true", Retries: -1}, wantErr: true},
+	}
+	for _, c := range cases {
+		if err := ConfigureHooks(c.opts); (err != nil) != c.wantErr {
+			t.Errorf("ConfigureHooks: test failed for %+v. got: %v", c.opts, err)
+		}
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	defer func(h HookOptions, d time.Duration, hs http.Header, c string) {
+		Hooks, hookRetryDelay, Headers, Cookies = h, d, hs, c
+	}(Hooks, hookRetryDelay, Headers, Cookies)
+	hookRetryDelay = 0
+	Headers = http.Header{"Authorization": {"Bearer media"}}
+	Cookies = "session=abc"
+	var events []hookEvent
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// the first attempt of every event fails
+		if requests%2 == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var e hookEvent
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&e) != nil {
+			t.Errorf("postHook: test failed. got wrong request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if r.Header.Get("Cookie") != "" || r.Header.Get("Authorization") != "" {
+			t.Errorf("postHook: test failed. got user credentials: %v", r.Header)
+		}
+		events = append(events, e)
+	}))
+	defer srv.Close()
+	output := filepath.Join(t.TempDir(), "1.mp4")
+	if err := ioutil.WriteFile(output, []byte("12345"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	Hooks = HookOptions{URL: srv.URL + "/secret", Retries: 1}
+
+	startJob("1_chunked", "1", "chunked", output, 10.5).finish()
+	failed := startJob("1_480p30", "1", "480p30", output, 10.5)
+	failJobs(errors.New("ffmpeg failed"))
+	// finished job doesn't fail
+	failed.finish()
+
+	want := []hookEvent{
+		{Event: HookStarted, Job: "1_chunked", VODID: "1", Quality: "chunked", Output: output, Duration: 10.5},
+		{Event: HookFinished, Job: "1_chunked", VODID: "1", Quality: "chunked", Output: output, Duration: 10.5, Size: 5},
+		{Event: HookStarted, Job: "1_480p30", VODID: "1", Quality: "480p30", Output: output, Duration: 10.5},
+		{Event: HookFailed, Job: "1_480p30", VODID: "1", Quality: "480p30", Output: output, Duration: 10.5, Error: "ffmpeg failed"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("postHook: test failed. got %d events: %+v. want: %d", len(events), events, len(want))
+	}
+	for i, e := range events {
+		if e.Time.IsZero() || e.Elapsed < 0 {
+			t.Errorf("postHook: test failed. got no time in %+v", e)
+		}
+		e.Time, e.Elapsed = time.Time{}, 0
+		if e != want[i] {
+			t.Errorf("postHook: test failed. got: %+v. want: %+v", e, want[i])
+		}
+	}
+
+	Hooks = HookOptions{URL: srv.URL, Retries: 0, Events: []string{HookFailed}}
+	requests = 0
+	startJob("2", "2", "chunked", output, 1).finish()
+	if requests != 0 {
+		t.Errorf("postHook: test failed. disabled events were sent")
+	}
+}
+
+func TestHookCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook command test uses sh")
+	}
+	defer func(h HookOptions, d time.Duration) { Hooks, hookRetryDelay = h, d }(Hooks, hookRetryDelay)
+	hookRetryDelay = 0
+	dir := t.TempDir()
+	out := filepath.Join(dir, "env")
+	Hooks = HookOptions{
+		Command: `echo "$TTVLDR_HOOK_EVENT $TTVLDR_HOOK_VOD_ID $TTVLDR_HOOK_QUALITY $TTVLDR_HOOK_OUTPUT $TTVLDR_HOOK_SIZE $TTVLDR_HOOK_DURATION" >> ` + out,
+		Events:  []string{HookFinished},
+		Timeout: 10 * time.Second,
+	}
+	startJob("1", "1", "chunked", filepath.Join(dir, "env"), 10.5).finish()
+	got, err := ioutil.ReadFile(out)
+	want := "finished 1 chunked " + out + " 0 10.500\n"
+	if err != nil || string(got) != want {
+		t.Errorf("runHookCommand: test failed. got: %q, %v. want: %q", got, err, want)
+	}
+
+	// failing command is retried and its error is reported
+	count := filepath.Join(dir, "count")
+	opts := HookOptions{Command: "echo x >> " + count + "; echo oops >&2; exit 3", Retries: 2}
+	err = retryHook(opts, func() error { return runHookCommand(opts, hookEvent{}) })
+	runs, _ := ioutil.ReadFile(count)
+	if err == nil || !strings.Contains(err.Error(), "oops") || strings.Count(string(runs), "x") != 3 {
+		t.Errorf("runHookCommand: test failed. got: %v after %d runs", err, strings.Count(string(runs), "x"))
+	}
+
+	opts = HookOptions{Command: "exec sleep 5", Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	if err = runHookCommand(opts, hookEvent{}); err == nil || time.Since(start) > 3*time.Second {
+		t.Errorf("runHookCommand: test failed. timeout didn't stop the command. got: %v", err)
+	}
+	os.Remove(count)
+}
@@ -0,0 +1,202 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPOptions configure the client every request of the package goes through.
+// Zero timeout means no timeout
+type HTTPOptions struct {
+	// ConnectTimeout limits establishing of TCP connection
+	ConnectTimeout time.Duration
+	// TLSHandshakeTimeout limits TLS handshake
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout limits waiting for response headers after the request is sent
+	ResponseHeaderTimeout time.Duration
+	// IdleConnTimeout closes keep-alive connections that were idle for this long
+	IdleConnTimeout time.Duration
+	// RequestTimeout is a deadline for API and playlist requests including reading of the body
+	RequestTimeout time.Duration
+	// SegmentTimeout is a deadline for downloading of a single segment
+	SegmentTimeout time.Duration
+	// MaxIdleConnsPerHost is the size of keep-alive pool per host
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits connections per host including active ones. 0 means no limit
+	MaxConnsPerHost int
+	// Proxy is http://, https:// or socks5:// proxy URL. Empty means proxy from HTTP_PROXY and HTTPS_PROXY
+	Proxy string
+	// UserAgent replaces default User-Agent if set
+	UserAgent string
+}
+
+var (
+	// HTTP are options of the client in use. Change them with ConfigureHTTP
+	HTTP = HTTPOptions{
+		ConnectTimeout:        30 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		RequestTimeout:        time.Minute,
+		SegmentTimeout:        10 * time.Minute,
+		MaxIdleConnsPerHost:   goroutinsLimit,
+	}
+	// Headers are extra HTTP headers sent with playlist, key and segment requests, e.g. to a HLS source.
+	// Twitch API requests and hooks never get them
+	Headers = http.Header{}
+	// Cookies are sent with playlist, key and segment requests, e.g. "session=abc; lang=en"
+	Cookies string
+
+	httpClient = mustHTTPClient(HTTP)
+)
+
+// ConfigureHTTP replaces the client used for all requests. It must be called before downloading
+func ConfigureHTTP(opts HTTPOptions) error {
+	c, err := newHTTPClient(opts)
+	if err != nil {
+		return err
+	}
+	HTTP, httpClient = opts, c
+	return nil
+}
+
+func newHTTPClient(opts HTTPOptions) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != "" {
+		u, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("newHTTPClient: cannot parse proxy URL %s. %s", opts.Proxy, err.Error())
+		}
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+			return nil, fmt.Errorf("newHTTPClient: unsupported proxy scheme %s. Use http, https or socks5", u.Scheme)
+		}
+		proxy = http.ProxyURL(u)
+	}
+	dialer := &net.Dialer{
+		Timeout:   opts.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 proxy,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+			ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+			IdleConnTimeout:       opts.IdleConnTimeout,
+			MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+			MaxConnsPerHost:       opts.MaxConnsPerHost,
+			ForceAttemptHTTP2:     true,
+		},
+	}, nil
+}
+
+func mustHTTPClient(opts HTTPOptions) *http.Client {
+	c, err := newHTTPClient(opts)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// newRequest creates a request with user defined User-Agent.
+// Callers may override it with their own headers
+func newRequest(method, link string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, link, body)
+	if err != nil {
+		return nil, err
+	}
+	setUserAgent(req)
+	return req, nil
+}
+
+// setMediaHeaders sets user defined headers and cookies of a playlist, key or segment request
+func setMediaHeaders(req *http.Request) {
+	for k, v := range Headers {
+		req.Header[k] = v
+	}
+	if Cookies != "" {
+		req.Header.Set("Cookie", Cookies)
+	}
+}
+
+// setUserAgent sets user defined User-Agent of the request
+func setUserAgent(req *http.Request) {
+	if HTTP.UserAgent != "" {
+		req.Header.Set("User-Agent", HTTP.UserAgent)
+	}
+}
+
+// doRequest sends the request with the shared client. Timeout covers reading of the body too,
+// so the body must be closed
+func doRequest(req *http.Request, timeout time.Duration) (*http.Response, error) {
+	if timeout <= 0 {
+		return httpClient.Do(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases request context when the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// httpGet issues GET request for an API endpoint
+func httpGet(link string) (*http.Response, error) {
+	req, err := newRequest("GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	return doRequest(req, HTTP.RequestTimeout)
+}
+
+// mediaGet issues GET request for a playlist, a key or a segment with user defined headers and cookies
+func mediaGet(link string, timeout time.Duration) (*http.Response, error) {
+	req, err := newRequest("GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	setMediaHeaders(req)
+	return doRequest(req, timeout)
+}
+
+// playlistGet issues GET request for a playlist or a key
+func playlistGet(link string) (*http.Response, error) {
+	return mediaGet(link, HTTP.RequestTimeout)
+}
+
+// segmentGet issues GET request for a media segment
+func segmentGet(link string) (*http.Response, error) {
+	return segmentRangeGet(link, nil)
+}
+
+// segmentRangeGet issues GET request for a byte range of a media segment or for the whole segment if br is nil
+func segmentRangeGet(link string, br *byteRange) (*http.Response, error) {
+	req, err := newRequest("GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	setMediaHeaders(req)
+	if br != nil {
+		req.Header.Set("Range", br.header())
+	}
+	return doRequest(req, HTTP.SegmentTimeout)
+}
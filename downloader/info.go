@@ -0,0 +1,259 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zerospiel/ttvldr/internal/helix"
+)
+
+// maxFileNameLength keeps sanitised file names within limits of common filesystems
+const maxFileNameLength = 200
+
+// vodReport is VOD info with all its renditions. Its JSON is the schema of -info -json,
+// so fields may be added but never renamed or removed
+type vodReport struct {
+	helix.Video
+	DurationSeconds int         `json:"duration_seconds"`
+	Streamer        *streamer   `json:"streamer"`
+	Renditions      []rendition `json:"renditions"`
+}
+
+// rendition is a quality option of the VOD
+type rendition struct {
+	Quality    string  `json:"quality"`
+	Resolution string  `json:"resolution"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	FrameRate  float64 `json:"frame_rate"`
+	Bandwidth  int     `json:"bandwidth"`
+	Codecs     string  `json:"codecs"`
+	URL        string  `json:"url"`
+	// EstimatedSize is the size of the full VOD in this quality in bytes
+	EstimatedSize uint64 `json:"estimated_size"`
+}
+
+func newVODReport(vi *helix.Video, vs []variant) *vodReport {
+	r := &vodReport{
+		Video:      *vi,
+		Streamer:   streamerOfVideo(vi),
+		Renditions: make([]rendition, 0, len(vs)),
+	}
+	if d, err := time.ParseDuration(vi.Duration); err == nil {
+		r.DurationSeconds = int(d.Seconds())
+	}
+	if r.MutedSegments == nil {
+		r.MutedSegments = []helix.MutedSegment{}
+	}
+	for _, v := range vs {
+		rd := rendition{
+			Quality:    v.name,
+			Resolution: v.resolution,
+			FrameRate:  v.frameRate,
+			Bandwidth:  v.bandwidth,
+			Codecs:     v.codecs,
+			URL:        v.uri,
+		}
+		rd.EstimatedSize = uint64(v.bandwidth / 8 * r.DurationSeconds)
+		if i := strings.Index(v.resolution, "x"); i >= 0 {
+			rd.Width, _ = strconv.Atoi(v.resolution[:i])
+			rd.Height, _ = strconv.Atoi(v.resolution[i+1:])
+		}
+		r.Renditions = append(r.Renditions, rd)
+	}
+	return r
+}
+
+// getVODReport retrieves VOD info and renditions concurrently and exits if any of them fails
+func getVODReport(vodID string) *vodReport {
+	done := make(chan []variant)
+	go func() {
+		vs, err := connectTwitchVariants(vodID)
+		if err != nil {
+			fatalConnectPrintf(err)
+		}
+		done <- vs
+	}()
+	vi, err := getVODInfo(vodID)
+	if errors.Is(err, helix.ErrUnauthorized) && HelixClientSecret == "" {
+		fatalPrintf(err, "Twitch API requires application credentials. Register an application at https://dev.twitch.tv/console and provide its -client-id and -client-secret\n")
+	}
+	if errors.Is(err, helix.ErrUnauthorized) {
+		fatalPrintf(err, "Twitch API rejected application credentials. Check -client-id and -client-secret\n%s\n", err.Error())
+	}
+	if err != nil {
+		fatalPrintf(err, "Could not retrieve data from server\n%s\n", err.Error())
+	}
+	s := resolveStreamer(vi)
+	r := newVODReport(vi, <-done)
+	r.Streamer = s
+	return r
+}
+
+// GetVODInfoJSON returns full info about VOD and its quality options as JSON
+func GetVODInfoJSON(vodID string) string {
+	b, err := json.MarshalIndent(getVODReport(vodID), "", "  ")
+	if err != nil {
+		fatalPrintf(err, "Could not encode VOD info\n")
+	}
+	return string(b) + "\n"
+}
+
+// GetVODInfoFormat returns info about VOD formatted with Go template, e.g. '{{.Title}} | {{.Duration}}'.
+// Fields are the same as in GetVODInfoJSON. Helpers are duration, size and filename, see infoFuncs
+func GetVODInfoFormat(vodID string, format string) string {
+	tmpl, err := parseInfoTemplate(format)
+	if err != nil {
+		fatalPrintf(err, "Wrong -format template. %s\n", err.Error())
+	}
+	out, err := executeInfoTemplate(tmpl, getVODReport(vodID))
+	if err != nil {
+		fatalPrintf(err, "Could not format VOD info. %s\n", err.Error())
+	}
+	return out
+}
+
+// OutputName is a Go template of output file names of Twitch VODs without extension, e.g.
+// '{{.Streamer.Login}}_{{.CreatedAt.Format "2006-01-02"}}_{{.ID}}'. Fields and helpers are the same
+// as in GetVODInfoFormat plus Quality, the name of the downloaded quality. Empty means VOD ID
+var OutputName string
+
+// outputNameData is the data of OutputName template
+type outputNameData struct {
+	*vodReport
+	Quality string
+}
+
+// outputNames returns output file names of the VOD playlists. Without OutputName it's the VOD ID.
+// If several playlists get the same name, their qualities are added to the names
+func outputNames(vodID string, vs []variant, pls []playlistInfo) ([]string, error) {
+	names := make([]string, len(pls))
+	if OutputName == "" {
+		for i := range pls {
+			names[i] = vodID
+		}
+		return uniqueNames(names, pls), nil
+	}
+	tmpl, err := parseInfoTemplate(OutputName)
+	if err != nil {
+		return nil, fmt.Errorf("outputNames: %s", err.Error())
+	}
+	vi, err := getVODInfo(vodID)
+	if err != nil {
+		return nil, fmt.Errorf("outputNames: %w", err)
+	}
+	s := resolveStreamer(vi)
+	r := newVODReport(vi, vs)
+	r.Streamer = s
+	for i, pl := range pls {
+		buf := bytes.NewBuffer(nil)
+		if err = tmpl.Execute(buf, outputNameData{vodReport: r, Quality: pl.quality}); err != nil {
+			return nil, fmt.Errorf("outputNames: %s", err.Error())
+		}
+		names[i] = sanitizeFileName(strings.TrimSpace(buf.String()))
+	}
+	return uniqueNames(names, pls), nil
+}
+
+func uniqueNames(names []string, pls []playlistInfo) []string {
+	seen := make(map[string]bool, len(names))
+	dup := false
+	for _, n := range names {
+		dup = dup || seen[n]
+		seen[n] = true
+	}
+	if dup {
+		for i := range names {
+			names[i] += "_" + pls[i].quality
+		}
+	}
+	return names
+}
+
+// infoFuncs are helpers of -format templates
+var infoFuncs = template.FuncMap{
+	// duration formats seconds, time.Duration or Twitch duration like 1h2m3s as 1:02:03
+	"duration": formatDuration,
+	// size formats bytes like 1.5G
+	"size": func(n interface{}) (string, error) {
+		switch v := n.(type) {
+		case int:
+			return formatSize(uint64(v)), nil
+		case int64:
+			return formatSize(uint64(v)), nil
+		case uint64:
+			return formatSize(v), nil
+		}
+		return "", fmt.Errorf("size: unsupported type %T", n)
+	},
+	// filename makes a string safe to use as a file name
+	"filename": sanitizeFileName,
+}
+
+func parseInfoTemplate(format string) (*template.Template, error) {
+	tmpl, err := template.New("info").Funcs(infoFuncs).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("parseInfoTemplate: %s", err.Error())
+	}
+	return tmpl, nil
+}
+
+func executeInfoTemplate(tmpl *template.Template, data interface{}) (string, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("executeInfoTemplate: %s", err.Error())
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteString("\n")
+	}
+	return buf.String(), nil
+}
+
+func formatDuration(d interface{}) (string, error) {
+	var dur time.Duration
+	switch v := d.(type) {
+	case int:
+		dur = time.Duration(v) * time.Second
+	case time.Duration:
+		dur = v
+	case string:
+		var err error
+		if dur, err = time.ParseDuration(v); err != nil {
+			return "", fmt.Errorf("duration: %s", err.Error())
+		}
+	default:
+		return "", fmt.Errorf("duration: unsupported type %T", d)
+	}
+	s := int(dur.Seconds())
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s%3600/60, s%60), nil
+}
+
+// sanitizeFileName replaces characters forbidden in file names on Windows, macOS and Linux
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if len(name) > maxFileNameLength {
+		name = name[:maxFileNameLength]
+		// don't cut a multibyte character in half
+		for !utf8.ValidString(name) {
+			name = name[:len(name)-1]
+		}
+	}
+	if name == "" {
+		return "_"
+	}
+	return name
+}
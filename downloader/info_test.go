@@ -0,0 +1,158 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zerospiel/ttvldr/internal/helix"
+)
+
+func TestNewVODReport(t *testing.T) {
+	vi := &helix.Video{
+		ID:       "309711819",
+		Title:    "Keep On Rolling Rolling Rolling",
+		Duration: "1h17m14s",
+	}
+	vs := []variant{
+		{uri: "https://cdn/chunked/index.m3u8", name: "chunked", bandwidth: 6335149, resolution: "1920x1080", frameRate: 60, codecs: "avc1.64002A,mp4a.40.2"},
+		{uri: "https://cdn/audio_only/index.m3u8", name: "audio_only", bandwidth: 160000, codecs: "mp4a.40.2"},
+	}
+	got := newVODReport(vi, vs)
+	if got.DurationSeconds != 4634 {
+		t.Errorf("newVODReport: test failed. got duration: %d. want: %d", got.DurationSeconds, 4634)
+	}
+	want := []rendition{
+		{Quality: "chunked", Resolution: "1920x1080", Width: 1920, Height: 1080, FrameRate: 60, Bandwidth: 6335149, Codecs: "avc1.64002A,mp4a.40.2", URL: "https://cdn/chunked/index.m3u8", EstimatedSize: 3669632162},
+		{Quality: "audio_only", Bandwidth: 160000, Codecs: "mp4a.40.2", URL: "https://cdn/audio_only/index.m3u8", EstimatedSize: 92680000},
+	}
+	if !reflect.DeepEqual(got.Renditions, want) {
+		t.Errorf("newVODReport: test failed. got: %+v. want: %+v", got.Renditions, want)
+	}
+}
+
+func TestVODReportJSON(t *testing.T) {
+	b, err := json.Marshal(newVODReport(&helix.Video{}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(m))
+	for k := range m {
+		got = append(got, k)
+	}
+	sort.Strings(got)
+	want := []string{"created_at", "description", "duration", "duration_seconds", "id", "language", "muted_segments",
+		"published_at", "renditions", "stream_id", "streamer", "thumbnail_url", "title", "type", "url", "user_id", "user_login",
+		"user_name", "view_count", "viewable"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("vodReport: test failed. got keys: %v. want: %v", got, want)
+	}
+	if m["renditions"] == nil || m["muted_segments"] == nil {
+		t.Errorf("vodReport: test failed. empty lists must be [], not null: %s", b)
+	}
+}
+
+func TestInfoTemplate(t *testing.T) {
+	r := newVODReport(&helix.Video{
+		Title:     `Rolling: "the" best/worst?`,
+		Duration:  "1h2m3s",
+		UserLogin: "foo_bar",
+		UserName:  "Foo",
+		CreatedAt: time.Date(2018, 9, 13, 21, 47, 11, 0, time.UTC),
+	}, []variant{{name: "chunked", bandwidth: 8000000}})
+	cases := []struct {
+		format, want string
+		wantErr      bool
+	}{
+		{format: `{{.Title}} | {{.Duration}} | {{.CreatedAt.Format "2006-01-02"}}`, want: "Rolling: \"the\" best/worst? | 1h2m3s | 2018-09-13\n"},
+		{format: "{{duration .DurationSeconds}} {{duration .Duration}}\n", want: "1:02:03 1:02:03\n"},
+		{format: `{{range .Renditions}}{{.Quality}} {{size .EstimatedSize}}{{end}}`, want: "chunked 3.5G\n"},
+		{format: `{{filename .Title}}.mp4`, want: "Rolling_ _the_ best_worst_.mp4\n"},
+		{format: `{{.Streamer}} {{.Streamer.ProfileURL}}`, want: "Foo (foo_bar) https://www.twitch.tv/foo_bar\n"},
+		{format: `{{.NoSuchField}}`, wantErr: true},
+		{format: `{{size .Title}}`, wantErr: true},
+	}
+	for _, c := range cases {
+		tmpl, err := parseInfoTemplate(c.format)
+		if err != nil {
+			t.Fatalf("parseInfoTemplate: test failed. got an error: %s", err.Error())
+		}
+		got, err := executeInfoTemplate(tmpl, r)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("executeInfoTemplate: test failed for %s. got: %q, %v. want: %q", c.format, got, err, c.want)
+		}
+	}
+	if _, err := parseInfoTemplate("{{.Title"); err == nil {
+		t.Errorf("parseInfoTemplate: test failed. broken template was parsed")
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	cases := []struct {
+		input, want string
+	}{
+		{input: "plain name", want: "plain name"},
+		{input: `a<b>c:d"e/f\g|h?i*j`, want: "a_b_c_d_e_f_g_h_i_j"},
+		{input: " .hidden. ", want: "hidden"},
+		{input: "tab\there", want: "tab_here"},
+		{input: "...", want: "_"},
+		{input: strings.Repeat("я", 150), want: strings.Repeat("я", 100)},
+	}
+	for _, c := range cases {
+		got := sanitizeFileName(c.input)
+		if got != c.want {
+			t.Errorf("sanitizeFileName: test failed. got: %s. want: %s", got, c.want)
+		}
+	}
+}
+
+func TestOutputNames(t *testing.T) {
+	defer func(name, baseURL string) {
+		OutputName, helixBaseURL = name, baseURL
+		streamers.byID = map[string]*streamer{}
+	}(OutputName, helixBaseURL)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/helix/videos":
+			fmt.Fprint(w, `{"data":[{"id":"1","user_id":"42","title":"a/b","created_at":"2018-09-13T21:47:11Z"}]}`)
+		case "/helix/users":
+			fmt.Fprint(w, `{"data":[{"id":"42","login":"foo_bar","display_name":"Foo"}]}`)
+		}
+	}))
+	defer srv.Close()
+	helixBaseURL = srv.URL + "/helix"
+	streamers.byID = map[string]*streamer{}
+	pls := []playlistInfo{{quality: "chunked"}, {quality: "480p30"}}
+	cases := []struct {
+		name string
+		pls  []playlistInfo
+		want []string
+	}{
+		{"", pls[:1], []string{"1"}},
+		{"", pls, []string{"1_chunked", "1_480p30"}},
+		{`{{.Streamer.Login}}_{{.CreatedAt.Format "2006-01-02"}}_{{.Title}}`, pls[:1], []string{"foo_bar_2018-09-13_a_b"}},
+		{`{{.Streamer.Login}}_{{.ID}}`, pls, []string{"foo_bar_1_chunked", "foo_bar_1_480p30"}},
+		{`{{.ID}}-{{.Quality}}`, pls, []string{"1-chunked", "1-480p30"}},
+	}
+	for _, c := range cases {
+		OutputName = c.name
+		got, err := outputNames("1", nil, c.pls)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("outputNames: test failed for %q. got: %v, %v. want: %v", c.name, got, err, c.want)
+		}
+	}
+	OutputName = "{{.NoSuchField}}"
+	if _, err := outputNames("1", nil, pls); err == nil {
+		t.Errorf("outputNames: test failed. want an error for unknown field")
+	}
+}
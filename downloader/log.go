@@ -0,0 +1,133 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// LogFormatText writes records as key=value pairs
+	LogFormatText = "text"
+	// LogFormatJSON writes records as JSON lines
+	LogFormatJSON = "json"
+
+	redacted = "REDACTED"
+)
+
+// LogOptions configure diagnostic logs. User-facing progress is printed to stdout and is not affected
+type LogOptions struct {
+	// Output is where records are written, os.Stderr if nil
+	Output io.Writer
+	// Format is LogFormatText or LogFormatJSON
+	Format string
+	// Level is the minimum level of written records
+	Level slog.Level
+}
+
+var (
+	// logOptions are options of the logger in use
+	logOptions = LogOptions{Format: LogFormatText, Level: slog.LevelWarn}
+	logger, _  = newLogger(logOptions)
+
+	// secretParam matches signed query parameters, e.g. nauthsig=abc
+	secretParam = regexp.MustCompile(`(?i)([?&](?:nauth|nauthsig|token|sig|client_secret|access_token)=)[^&\s"]*`)
+	// secretOAuth matches OAuth and bearer tokens in headers and in oauth:<token> form
+	secretOAuth = regexp.MustCompile(`(?i)(\b(?:oauth|bearer)[ :])[a-z0-9]{20,}`)
+	// secretKeys are attribute keys whose values are never logged
+	secretKeys = map[string]bool{
+		"nauth":         true,
+		"nauthsig":      true,
+		"token":         true,
+		"sig":           true,
+		"oauth":         true,
+		"authorization": true,
+		"client_secret": true,
+		"access_token":  true,
+	}
+)
+
+// ConfigureLogging replaces the logger of the package
+func ConfigureLogging(opts LogOptions) error {
+	l, err := newLogger(opts)
+	if err != nil {
+		return err
+	}
+	logger, logOptions = l, opts
+	return nil
+}
+
+// enableDebugLogs lowers the level of the logger in use to debug, keeping its output and format
+func enableDebugLogs() {
+	if logOptions.Level <= slog.LevelDebug {
+		return
+	}
+	opts := logOptions
+	opts.Level = slog.LevelDebug
+	ConfigureLogging(opts)
+}
+
+func newLogger(opts LogOptions) (*slog.Logger, error) {
+	w := opts.Output
+	if w == nil {
+		w = os.Stderr
+	}
+	ho := &slog.HandlerOptions{Level: opts.Level, ReplaceAttr: redactAttr}
+	switch opts.Format {
+	case LogFormatText, "":
+		return slog.New(slog.NewTextHandler(w, ho)), nil
+	case LogFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, ho)), nil
+	}
+	return nil, fmt.Errorf("newLogger: unknown log format %s. Use %s or %s", opts.Format, LogFormatText, LogFormatJSON)
+}
+
+// redactAttr hides tokens, signatures and OAuth headers in messages and attributes
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if secretKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindAny:
+		if ss, ok := a.Value.Any().([]string); ok {
+			r := make([]string, len(ss))
+			for i := range ss {
+				r[i] = redactString(ss[i])
+			}
+			return slog.Any(a.Key, r)
+		}
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, redactString(err.Error()))
+		}
+		if s, ok := a.Value.Any().(fmt.Stringer); ok {
+			return slog.String(a.Key, redactString(s.String()))
+		}
+	}
+	return a
+}
+
+func redactString(s string) string {
+	s = secretParam.ReplaceAllString(s, "${1}"+redacted)
+	return secretOAuth.ReplaceAllString(s, "${1}"+redacted)
+}
+
+// fatalPrintf prints a message for the user, removes temporary files of running downloads, runs failed hooks and exits. The error itself is a diagnostic
+// detail, it's logged at debug level, so the message is not written twice with default logging
+func fatalPrintf(err error, format string, opts ...interface{}) {
+	if len(format) > 0 {
+		fmt.Fprintf(os.Stderr, format, opts...)
+	}
+	if err == nil {
+		err = errors.New("unknown error")
+	}
+	logger.Debug("fatal error", "err", err)
+	cleanupTemp()
+	failJobs(err)
+	os.Exit(1)
+}
@@ -0,0 +1,90 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedactString(t *testing.T) {
+	cases := []struct {
+		input, want string
+	}{
+		{
+			input: "http://usher.twitch.tv/vod/1?nauthsig=abc&nauth=%7B%22a%22%7D&allow_source=true",
+			want:  "http://usher.twitch.tv/vod/1?nauthsig=REDACTED&nauth=REDACTED&allow_source=true",
+		},
+		{input: "https://cdn/1.ts?token=abc&sig=def", want: "https://cdn/1.ts?token=REDACTED&sig=REDACTED"},
+		{input: "Authorization: OAuth abcdefghijklmnopqrstuvwxyz0123", want: "Authorization: OAuth REDACTED"},
+		{input: "oauth:abcdefghijklmnopqrstuvwxyz0123", want: "oauth:REDACTED"},
+		{input: "Provide your OAuth token", want: "Provide your OAuth token"},
+		{input: "https://cdn/1.ts?signature_version=2", want: "https://cdn/1.ts?signature_version=2"},
+	}
+	for _, c := range cases {
+		got := redactString(c.input)
+		if got != c.want {
+			t.Errorf("redactString: test failed. got: %s. want: %s", got, c.want)
+		}
+	}
+}
+
+func TestRedactUsherURL(t *testing.T) {
+	token := `{"authorization":{"forbidden":false,"reason":""},"chansub":{"restricted_bitrates":[]},"device_id":null,"expires":1539547293,"https_required":true,"privileged":false,"user_id":12345,"version":2,"vod_id":309711819}`
+	got := redactString("requesting Usher API " + usherURL("309711819", token, "0123456789abcdef"))
+	want := "requesting Usher API http://usher.twitch.tv/vod/309711819?allow_source=true&nauth=REDACTED&nauthsig=REDACTED"
+	if got != want {
+		t.Errorf("redactString: test failed. got: %s. want: %s", got, want)
+	}
+}
+
+func TestConfigureLogging(t *testing.T) {
+	defer func(l *slog.Logger) { logger = l }(logger)
+	buf := bytes.NewBuffer(nil)
+	if err := ConfigureLogging(LogOptions{Output: buf, Format: LogFormatJSON, Level: slog.LevelInfo}); err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("hidden")
+	logger.With("vod", "1").Info("request failed https://cdn/1.ts?sig=abc",
+		"token", "secret", "err", errors.New(`Get "https://cdn/1.ts?token=abc": timeout`))
+
+	var rec map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("ConfigureLogging: test failed. got not a single JSON record: %s", buf.String())
+	}
+	want := map[string]string{
+		"level": "INFO",
+		"msg":   "request failed https://cdn/1.ts?sig=REDACTED",
+		"vod":   "1",
+		"token": "REDACTED",
+		"err":   `Get "https://cdn/1.ts?token=REDACTED": timeout`,
+	}
+	for k, v := range want {
+		if rec[k] != v {
+			t.Errorf("ConfigureLogging: test failed for %s. got: %s. want: %s", k, rec[k], v)
+		}
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("ConfigureLogging: test failed. secret was logged: %s", buf.String())
+	}
+
+	if err := ConfigureLogging(LogOptions{Format: "xml"}); err == nil {
+		t.Errorf("ConfigureLogging: test failed. unknown format was accepted")
+	}
+}
+
+func TestDeprecatedDebug(t *testing.T) {
+	defer func(l *slog.Logger, opts LogOptions, d bool) { logger, logOptions, Debug = l, opts, d }(logger, logOptions, Debug)
+	buf := bytes.NewBuffer(nil)
+	if err := ConfigureLogging(LogOptions{Output: buf, Format: LogFormatJSON, Level: slog.LevelWarn}); err != nil {
+		t.Fatal(err)
+	}
+	Debug = true
+	checkOptions()
+	logger.Debug("visible")
+	if !strings.Contains(buf.String(), `"msg":"visible"`) {
+		t.Errorf("checkOptions: test failed. Debug didn't enable debug logs. got: %s", buf.String())
+	}
+}
@@ -0,0 +1,94 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/zerospiel/ttvldr/internal/helix"
+)
+
+const (
+	twitchVideoURL   = "https://www.twitch.tv/videos/"
+	coverFile        = "cover.jpg"
+	coverResolutionW = "1280"
+	coverResolutionH = "720"
+)
+
+// Metadata is a flag that enables writing VOD info and cover art into the output file
+var Metadata = true
+
+func getVODInfo(vodID string) (*helix.Video, error) {
+	videos, _, err := newHelixClient().GetVideos(context.Background(), helix.VideosQuery{IDs: []string{vodID}})
+	if errors.Is(err, helix.ErrNotFound) || (err == nil && len(videos) == 0) {
+		return nil, fmt.Errorf("getVODInfo: no VOD with ID %s", vodID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getVODInfo: cannot retreive VOD info via API. %w", err)
+	}
+	vi := &videos[0]
+	if vi.URL == "" {
+		vi.URL = twitchVideoURL + vodID
+	}
+	return vi, nil
+}
+
+// muxMetadata returns container tags built from the VOD info
+func muxMetadata(vi *helix.Video) [][2]string {
+	artist := vi.UserName
+	if artist == "" {
+		artist = vi.UserLogin
+	}
+	if artist == "" {
+		artist = vi.UserID
+	}
+	comment := vi.URL
+	if vi.Description != "" {
+		comment = vi.Description + "\n\n" + vi.URL
+	}
+	tags := [][2]string{
+		{"title", vi.Title},
+		{"artist", artist},
+	}
+	if !vi.CreatedAt.IsZero() {
+		tags = append(tags, [2]string{"date", vi.CreatedAt.Format("2006-01-02")})
+	}
+	tags = append(tags,
+		[2]string{"comment", comment},
+		[2]string{"description", vi.Description},
+		[2]string{"url", vi.URL},
+	)
+	return tags
+}
+
+// downloadCover saves the VOD thumbnail into the given directory
+func downloadCover(vi *helix.Video, path string) (string, error) {
+	if vi.ThumbnailURL == "" {
+		return "", errors.New("downloadCover: VOD has no thumbnail")
+	}
+	r := strings.NewReplacer("%{width}", coverResolutionW, "%{height}", coverResolutionH)
+	link := r.Replace(vi.ThumbnailURL)
+	logger.Debug("downloading cover", "url", link)
+	resp, err := httpGet(link)
+	if err != nil {
+		return "", fmt.Errorf("downloadCover: cannot retrieve thumbnail. %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloadCover: server responded with %d code", resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("downloadCover: cannot read thumbnail. %s", err.Error())
+	}
+	file := filepath.Join(path, coverFile)
+	if err = ioutil.WriteFile(file, data, 0400); err != nil {
+		return "", fmt.Errorf("downloadCover: could not write in file. %s", err.Error())
+	}
+	return file, nil
+}
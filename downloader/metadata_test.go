@@ -0,0 +1,79 @@
+package downloader
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zerospiel/ttvldr/internal/helix"
+)
+
+func TestMuxMetadata(t *testing.T) {
+	vi := &helix.Video{
+		UserID:    "116245074",
+		Title:     "Keep On Rolling Rolling Rolling",
+		CreatedAt: time.Date(2018, 9, 13, 21, 47, 11, 0, time.UTC),
+		URL:       "https://www.twitch.tv/videos/309711819",
+	}
+	want := [][2]string{
+		{"title", "Keep On Rolling Rolling Rolling"},
+		{"artist", "116245074"},
+		{"date", "2018-09-13"},
+		{"comment", "https://www.twitch.tv/videos/309711819"},
+		{"description", ""},
+		{"url", "https://www.twitch.tv/videos/309711819"},
+	}
+	if got := muxMetadata(vi); !reflect.DeepEqual(got, want) {
+		t.Errorf("muxMetadata: test failed. got: %v. want: %v", got, want)
+	}
+
+	vi.UserName, vi.Description = "baggins_tv", "some text"
+	got := muxMetadata(vi)
+	if got[1][1] != "baggins_tv" || got[3][1] != "some text\n\nhttps://www.twitch.tv/videos/309711819" {
+		t.Errorf("muxMetadata: test failed. got: %v", got)
+	}
+}
+
+func TestFFMpegConcatArgs(t *testing.T) {
+	defer func(c string, a bool) { Container, AudioOnly = c, a }(Container, AudioOnly)
+	opts := muxOptions{subs: "1_chat.ass", cover: "tmp/cover.jpg", metadata: [][2]string{{"title", "foo bar"}}}
+	cases := []struct {
+		container string
+		audioOnly bool
+		opts      muxOptions
+		want      []string
+	}{
+		{
+			container: containerMP4,
+			want:      []string{"-f", "concat", "-safe", "0", "-i", "list", "-c", "copy", "-fflags", "+genpts", "-bsf:a", "aac_adtstoasc", "-f", "mp4", "1.mp4.part"},
+		},
+		{
+			container: containerMP4,
+			opts:      opts,
+			want: []string{"-f", "concat", "-safe", "0", "-i", "list", "-i", "1_chat.ass", "-i", "tmp/cover.jpg",
+				"-map", "0:v?", "-map", "0:a?", "-map", "1", "-map", "2", "-c", "copy", "-c:s", "mov_text", "-metadata:s:s:0", "title=Chat",
+				"-disposition:v:1", "attached_pic", "-metadata", "title=foo bar", "-fflags", "+genpts", "-bsf:a", "aac_adtstoasc", "-f", "mp4", "1.mp4.part"},
+		},
+		{
+			container: containerMKV,
+			opts:      opts,
+			want: []string{"-f", "concat", "-safe", "0", "-i", "list", "-i", "1_chat.ass",
+				"-map", "0:v?", "-map", "0:a?", "-map", "1", "-c", "copy", "-c:s", "ass", "-metadata:s:s:0", "title=Chat",
+				"-attach", "tmp/cover.jpg", "-metadata:s:t", "mimetype=image/jpeg", "-metadata:s:t", "filename=cover.jpg",
+				"-metadata", "title=foo bar", "-fflags", "+genpts", "-bsf:a", "aac_adtstoasc", "-f", "matroska", "1.mkv.part"},
+		},
+		{
+			container: containerMKV,
+			audioOnly: true,
+			opts:      muxOptions{metadata: opts.metadata},
+			want: []string{"-f", "concat", "-safe", "0", "-i", "list", "-vn", "-c:a", "copy",
+				"-metadata", "title=foo bar", "-fflags", "+genpts", "-bsf:a", "aac_adtstoasc", "-f", "ipod", "1.m4a.part"},
+		},
+	}
+	for _, c := range cases {
+		Container, AudioOnly = c.container, c.audioOnly
+		if got := ffmpegConcatArgs("list", "1."+outputExtension()+partExtension, c.opts); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ffmpegConcatArgs: test failed. got: %v. want: %v", got, c.want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	qualitySource    = "source"
+	qualityBest      = "best"
+	qualityWorst     = "worst"
+	qualityAudioOnly = "audio_only"
+	// audioOnlyQuality is used in AudioOnly mode, audio is extracted from the lowest video quality if needed
+	audioOnlyQuality = qualityAudioOnly + "," + qualityWorst
+)
+
+var (
+	// ErrNoQuality is returned by DownloadVOD, DownloadPlaylist and DownloadHLS if no quality or variant matches
+	ErrNoQuality = errors.New("no quality matches")
+
+	// qualityName is a quality like 720p, 720p60 or 1080p60 (source)
+	qualityName = regexp.MustCompile(`^(\d+)p(\d+)?\b`)
+)
+
+// qualityRule is a single rule of -quality. Rules are separated by comma and tried in order:
+// best, worst, source, audio_only, exact name like 720p60 or 720p, or bound like >=720p and <=480p30
+type qualityRule struct {
+	raw string
+	// op is "", ">=" or "<=". Without op the rule matches by name or by height and fps
+	op     string
+	height int
+	// fps is 0 if the rule doesn't limit it
+	fps int
+}
+
+// qualitySeparator separates qualities to download together, e.g. chunked+480p30
+const qualitySeparator = "+"
+
+// splitQualities splits quality into rule lists of separate downloads
+func splitQualities(quality string) []string {
+	var qs []string
+	for _, q := range strings.Split(quality, qualitySeparator) {
+		if q = strings.TrimSpace(q); q != "" {
+			qs = append(qs, q)
+		}
+	}
+	if len(qs) == 0 {
+		// selectQuality explains the empty rule list
+		return []string{quality}
+	}
+	return qs
+}
+
+// qualitySelectors returns rule lists of separate downloads. Qualities separated by + are downloaded together,
+// and so are comma separated ones if every one of them is an exact name of an available quality, e.g. chunked,480p30.
+// Otherwise comma separated rules are a fallback list of a single download
+func qualitySelectors(vs []variant, quality string) []string {
+	var selectors []string
+	for _, q := range splitQualities(quality) {
+		if names := exactQualities(vs, q); len(names) > 1 {
+			selectors = append(selectors, names...)
+			continue
+		}
+		selectors = append(selectors, q)
+	}
+	return selectors
+}
+
+// exactQualities returns comma separated names of selector if all of them are names of available qualities
+func exactQualities(vs []variant, selector string) []string {
+	var names []string
+	for _, raw := range strings.Split(selector, ",") {
+		raw = strings.TrimSpace(raw)
+		found := false
+		for _, v := range vs {
+			if strings.EqualFold(v.name, raw) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+		names = append(names, raw)
+	}
+	return names
+}
+
+// parseQuality parses comma separated quality rules, e.g. 1080p60,720p60,best
+func parseQuality(selector string) ([]qualityRule, error) {
+	var rules []qualityRule
+	for _, raw := range strings.Split(selector, ",") {
+		raw = strings.ToLower(strings.TrimSpace(raw))
+		if raw == "" {
+			continue
+		}
+		r := qualityRule{raw: raw}
+		rest := raw
+		for _, op := range []string{">=", "<="} {
+			if strings.HasPrefix(raw, op) {
+				r.op, rest = op, strings.TrimSpace(raw[len(op):])
+			}
+		}
+		if m := qualityName.FindStringSubmatch(rest); m != nil && len(m[0]) == len(rest) {
+			r.height, _ = strconv.Atoi(m[1])
+			r.fps, _ = strconv.Atoi(m[2])
+		} else if r.op != "" {
+			return nil, fmt.Errorf("parseQuality: %s must be a resolution like 720p or 720p60", raw)
+		}
+		rules = append(rules, r)
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("parseQuality: no quality rules")
+	}
+	return rules, nil
+}
+
+// videoSize returns height and frame rate of the variant from its attributes or its name. Audio only variants are 0, 0
+func videoSize(v variant) (height, fps int) {
+	if i := strings.Index(v.resolution, "x"); i >= 0 {
+		height, _ = strconv.Atoi(v.resolution[i+1:])
+		fps = int(v.frameRate + .5)
+	}
+	if m := qualityName.FindStringSubmatch(v.name); m != nil {
+		if height == 0 {
+			height, _ = strconv.Atoi(m[1])
+		}
+		if fps == 0 {
+			fps, _ = strconv.Atoi(m[2])
+		}
+	}
+	return height, fps
+}
+
+// isAudioOnly reports whether the variant has no video, like Twitch audio_only
+func isAudioOnly(v variant) bool {
+	if strings.EqualFold(v.name, qualityAudioOnly) {
+		return true
+	}
+	return v.resolution == "" && strings.HasPrefix(v.codecs, "mp4a") && !strings.Contains(v.codecs, ",")
+}
+
+// betterVariant compares variants by height, then frame rate, then bandwidth
+func betterVariant(a, b variant) bool {
+	ah, af := videoSize(a)
+	bh, bf := videoSize(b)
+	if ah != bh {
+		return ah > bh
+	}
+	if af != bf {
+		return af > bf
+	}
+	return a.bandwidth > b.bandwidth
+}
+
+// matches reports whether the variant satisfies the rule. Named rules are handled by selectQuality
+func (r qualityRule) matches(v variant) bool {
+	if strings.ToLower(v.name) == r.raw {
+		return true
+	}
+	h, fps := videoSize(v)
+	if r.height == 0 || h == 0 {
+		return false
+	}
+	switch r.op {
+	case ">=":
+		return h > r.height || (h == r.height && (r.fps == 0 || fps >= r.fps))
+	case "<=":
+		return h < r.height || (h == r.height && (r.fps == 0 || fps <= r.fps))
+	}
+	return h == r.height && (r.fps == 0 || fps == r.fps)
+}
+
+// candidates returns variants matching the rule. best and worst take video variants unless there are none
+func (r qualityRule) candidates(vs []variant) []variant {
+	var matched, video, audio []variant
+	for _, v := range vs {
+		if isAudioOnly(v) {
+			audio = append(audio, v)
+		} else {
+			video = append(video, v)
+		}
+	}
+	if len(video) == 0 {
+		video = vs
+	}
+	switch r.raw {
+	case qualityBest, qualityWorst:
+		return video
+	case qualitySource:
+		for _, v := range vs {
+			if v.name == defaultQuality {
+				matched = append(matched, v)
+			}
+		}
+	case qualityAudioOnly:
+		return audio
+	default:
+		for _, v := range vs {
+			if r.matches(v) {
+				matched = append(matched, v)
+			}
+		}
+	}
+	return matched
+}
+
+// skippedQualities returns renditions named by the rules after the first matching one. Such a selector
+// like 1440p,chunked,480p30 is likely meant to download several qualities, which are separated by +
+func skippedQualities(vs []variant, selector string) []string {
+	rules, err := parseQuality(selector)
+	if err != nil {
+		return nil
+	}
+	var skipped []string
+	matched := false
+	for _, r := range rules {
+		if !matched {
+			matched = len(r.candidates(vs)) > 0
+			continue
+		}
+		for _, v := range vs {
+			if strings.ToLower(v.name) == r.raw {
+				skipped = append(skipped, v.name)
+			}
+		}
+	}
+	return skipped
+}
+
+// selectQuality chooses a variant by comma separated quality rules, trying them in order.
+// Among variants matching a rule the best one is chosen. source is Twitch source quality, chunked.
+// best and worst don't choose audio only variants unless there is nothing else
+func selectQuality(vs []variant, selector string) (variant, error) {
+	rules, err := parseQuality(selector)
+	if err != nil {
+		return variant{}, err
+	}
+	for _, r := range rules {
+		candidates := r.candidates(vs)
+		if len(candidates) == 0 {
+			continue
+		}
+		chosen := candidates[0]
+		for _, v := range candidates[1:] {
+			if betterVariant(v, chosen) == (r.raw != qualityWorst) {
+				chosen = v
+			}
+		}
+		return chosen, nil
+	}
+	names := make([]string, 0, len(vs))
+	for _, v := range vs {
+		names = append(names, v.name)
+	}
+	return variant{}, fmt.Errorf("selectQuality: %w %s. Available: %s", ErrNoQuality, selector, strings.Join(names, ", "))
+}
@@ -0,0 +1,155 @@
+package downloader
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSelectQuality(t *testing.T) {
+	vs := []variant{
+		{name: "chunked", uri: "chunked", resolution: "1920x1080", frameRate: 60, bandwidth: 6335149},
+		{name: "720p60", uri: "720p60", resolution: "1280x720", frameRate: 60, bandwidth: 3421991},
+		{name: "720p30", uri: "720p30", resolution: "1280x720", frameRate: 30, bandwidth: 2373000},
+		{name: "480p30", uri: "480p30", resolution: "852x480", frameRate: 30, bandwidth: 1427999},
+		{name: "360p30", uri: "360p30", bandwidth: 630000},
+		{name: "160p30", uri: "160p30", resolution: "284x160", frameRate: 30, bandwidth: 230000},
+		{name: "audio_only", uri: "audio_only", bandwidth: 160000, codecs: "mp4a.40.2"},
+	}
+	cases := []struct {
+		input, want string
+		wantErr     bool
+	}{
+		{input: "chunked", want: "chunked"},
+		{input: "source", want: "chunked"},
+		{input: "best", want: "chunked"},
+		{input: "worst", want: "160p30"},
+		{input: "audio_only", want: "audio_only"},
+		{input: "720p60", want: "720p60"},
+		{input: "720P30", want: "720p30"},
+		{input: "720p", want: "720p60"},
+		{input: "360p", want: "360p30"},
+		{input: ">=720p", want: "chunked"},
+		{input: "<=720p30", want: "720p30"},
+		{input: "<=480p30", want: "480p30"},
+		{input: "<= 500p", want: "480p30"},
+		{input: "1440p60,720p60,best", want: "720p60"},
+		{input: " 1440p , >=1440p , worst", want: "160p30"},
+		{input: "<=100p", wantErr: true},
+		{input: "4k", wantErr: true},
+		{input: ">=best", wantErr: true},
+		{input: " , ", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := selectQuality(vs, c.input)
+		if (err != nil) != c.wantErr || got.uri != c.want {
+			t.Errorf("selectQuality: test failed for %s. got: %s, %v. want: %s", c.input, got.uri, err, c.want)
+		}
+	}
+	if _, err := selectQuality(vs, "1440p"); !errors.Is(err, ErrNoQuality) {
+		t.Errorf("selectQuality: test failed. got: %v. want: %v", err, ErrNoQuality)
+	}
+
+	// playlists without Twitch names
+	vs = []variant{
+		{name: "2000k", uri: "a", bandwidth: 2000000},
+		{name: "800k", uri: "b", bandwidth: 800000},
+		{name: "64k", uri: "c", bandwidth: 64000, codecs: "mp4a.40.2"},
+	}
+	cases = []struct {
+		input, want string
+		wantErr     bool
+	}{
+		{input: "source,best", want: "a"},
+		{input: "worst", want: "b"},
+		{input: "audio_only", want: "c"},
+		{input: "800k", want: "b"},
+		{input: "<=720p", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := selectQuality(vs, c.input)
+		if (err != nil) != c.wantErr || got.uri != c.want {
+			t.Errorf("selectQuality: test failed for %s. got: %s, %v. want: %s", c.input, got.uri, err, c.want)
+		}
+	}
+}
+
+func TestSplitQualities(t *testing.T) {
+	cases := []struct {
+		input string
+		want  []string
+	}{
+		{input: "chunked", want: []string{"chunked"}},
+		{input: "chunked+480p30", want: []string{"chunked", "480p30"}},
+		{input: "source,best + <=480p30,worst", want: []string{"source,best", "<=480p30,worst"}},
+		{input: "+720p60+", want: []string{"720p60"}},
+		{input: "", want: []string{""}},
+	}
+	for _, c := range cases {
+		got := splitQualities(c.input)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("splitQualities: test failed. got: %q. want: %q", got, c.want)
+		}
+	}
+}
+
+func TestDownloadNoQuality(t *testing.T) {
+	defer func(c, m bool, s string) { Chat, Metadata, Subtitles = c, m, s }(Chat, Metadata, Subtitles)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testMasterPlaylist))
+	}))
+	defer srv.Close()
+	link := srv.URL + "/master.m3u8"
+	if err := DownloadPlaylist(link, "0", "-1", "1440p"); !errors.Is(err, ErrNoQuality) {
+		t.Errorf("DownloadPlaylist: test failed. got: %v. want: %v", err, ErrNoQuality)
+	}
+	if err := DownloadHLS(link, "0", "-1", "640x360"); !errors.Is(err, ErrNoQuality) {
+		t.Errorf("DownloadHLS: test failed. got: %v. want: %v", err, ErrNoQuality)
+	}
+	if err := DownloadPlaylist(link, "0", "-1", "chunked+480p30"); err == nil {
+		t.Errorf("DownloadPlaylist: test failed. want an error for several qualities")
+	}
+}
+
+func TestSkippedQualities(t *testing.T) {
+	vs := []variant{{name: "chunked"}, {name: "720p60"}, {name: "480p30"}, {name: "audio_only"}}
+	cases := []struct {
+		selector string
+		want     []string
+	}{
+		{"chunked,480p30", []string{"480p30"}},
+		{"1080p60,720p60,best", nil},
+		{"1080p60,720p60,480p30", []string{"480p30"}},
+		{"source,best", nil},
+		{"chunked", nil},
+		{"1440p,240p", nil},
+	}
+	for _, c := range cases {
+		if got := skippedQualities(vs, c.selector); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("skippedQualities: test failed for %s. got: %v. want: %v", c.selector, got, c.want)
+		}
+	}
+}
+
+func TestQualitySelectors(t *testing.T) {
+	vs := []variant{{name: "chunked"}, {name: "720p60"}, {name: "480p30"}, {name: "audio_only"}}
+	cases := []struct {
+		quality string
+		want    []string
+	}{
+		{"chunked,480p30", []string{"chunked", "480p30"}},
+		{"Chunked, 480p30", []string{"Chunked", "480p30"}},
+		{"chunked+480p30", []string{"chunked", "480p30"}},
+		{"source,best+<=480p30,worst", []string{"source,best", "<=480p30,worst"}},
+		{"1080p60,720p60,best", []string{"1080p60,720p60,best"}},
+		{"1440p,chunked,480p30", []string{"1440p,chunked,480p30"}},
+		{"chunked", []string{"chunked"}},
+	}
+	for _, c := range cases {
+		if got := qualitySelectors(vs, c.quality); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("qualitySelectors: test failed for %s. got: %v. want: %v", c.quality, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rateLimitChunk = 32 * 1024
+
+// rateWindow is a time of day interval with its own rate, e.g. 09:00-18:00=1M
+type rateWindow struct {
+	from, to int // minutes since midnight
+	rate     int64
+}
+
+func (w rateWindow) contains(minute int) bool {
+	if w.from <= w.to {
+		return minute >= w.from && minute < w.to
+	}
+	// interval goes over midnight
+	return minute >= w.from || minute < w.to
+}
+
+// rateLimiter is a token bucket shared by all download workers
+type rateLimiter struct {
+	mu       sync.Mutex
+	rate     int64
+	schedule []rateWindow
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
+}
+
+var limiter = &rateLimiter{now: time.Now}
+
+// SetRateLimit sets download speed limit in bytes per second for all downloads. 0 means no limit.
+// It's safe to call while downloading
+func SetRateLimit(bytesPerSec int64) {
+	limiter.mu.Lock()
+	limiter.rate = bytesPerSec
+	limiter.mu.Unlock()
+}
+
+// SetRateSchedule sets time of day intervals with their own speed limits, e.g. "09:00-18:00=1M,22:00-06:00=0".
+// Outside of the intervals the limit set by SetRateLimit is used. It's safe to call while downloading
+func SetRateSchedule(schedule string) error {
+	ws, err := parseRateSchedule(schedule)
+	if err != nil {
+		return err
+	}
+	limiter.mu.Lock()
+	limiter.schedule = ws
+	limiter.mu.Unlock()
+	return nil
+}
+
+// ParseRate parses speed like 500k or 5M into bytes per second. k and M are 1024 and 1024*1024
+func ParseRate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k") || strings.HasSuffix(s, "K"):
+		mult, s = 1024, s[:len(s)-1]
+	case strings.HasSuffix(s, "m") || strings.HasSuffix(s, "M"):
+		mult, s = 1024*1024, s[:len(s)-1]
+	case strings.HasSuffix(s, "g") || strings.HasSuffix(s, "G"):
+		mult, s = 1024*1024*1024, s[:len(s)-1]
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("ParseRate: wrong rate %s", s)
+	}
+	return int64(f * float64(mult)), nil
+}
+
+func parseRateSchedule(schedule string) ([]rateWindow, error) {
+	var ws []rateWindow
+	for _, item := range strings.Split(schedule, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		eq, dash := strings.Index(item, "="), strings.Index(item, "-")
+		if eq < 0 || dash < 0 || dash > eq {
+			return nil, fmt.Errorf("parseRateSchedule: %s is not in 'HH:MM-HH:MM=rate' format", item)
+		}
+		from, err := parseClock(item[:dash])
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseClock(item[dash+1 : eq])
+		if err != nil {
+			return nil, err
+		}
+		rate, err := ParseRate(item[eq+1:])
+		if err != nil {
+			return nil, err
+		}
+		ws = append(ws, rateWindow{from: from, to: to, rate: rate})
+	}
+	return ws, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("parseClock: wrong time %s. Correct format: 09:30", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// currentRate returns the limit for the given moment, the caller must hold the lock
+func (l *rateLimiter) currentRate(now time.Time) int64 {
+	minute := now.Hour()*60 + now.Minute()
+	for _, w := range l.schedule {
+		if w.contains(minute) {
+			return w.rate
+		}
+	}
+	return l.rate
+}
+
+// reserve takes n bytes from the bucket and returns how long the caller has to wait for them
+func (l *rateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	rate := l.currentRate(now)
+	if rate <= 0 {
+		l.tokens, l.last = 0, now
+		return 0
+	}
+	if l.last.IsZero() {
+		l.tokens = float64(rate)
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+	}
+	// burst is no more than a second of traffic
+	if l.tokens > float64(rate) {
+		l.tokens = float64(rate)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+}
+
+// limitedReader slows down reading according to the shared limiter
+type limitedReader struct {
+	r io.Reader
+}
+
+func (lr limitedReader) Read(p []byte) (int, error) {
+	if len(p) > rateLimitChunk {
+		p = p[:rateLimitChunk]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		time.Sleep(limiter.reserve(n))
+	}
+	return n, err
+}
@@ -0,0 +1,86 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	cases := []struct {
+		input string
+		want  int64
+		err   bool
+	}{
+		{input: "0", want: 0},
+		{input: "1000", want: 1000},
+		{input: "500k", want: 500 * 1024},
+		{input: "5M", want: 5 * 1024 * 1024},
+		{input: "1.5m", want: 1572864},
+		{input: "1G", want: 1024 * 1024 * 1024},
+		{input: "-1", err: true},
+		{input: "fast", err: true},
+	}
+	for _, c := range cases {
+		got, err := ParseRate(c.input)
+		if (err != nil) != c.err || got != c.want {
+			t.Errorf("ParseRate: test failed for %s. got: %d. want: %d. err: %v", c.input, got, c.want, err)
+		}
+	}
+}
+
+func TestParseRateSchedule(t *testing.T) {
+	ws, err := parseRateSchedule("09:00-18:00=1M, 22:30-06:00=0")
+	if err != nil {
+		t.Fatalf("parseRateSchedule: test failed. got an error: %s", err.Error())
+	}
+	want := []rateWindow{{from: 540, to: 1080, rate: 1024 * 1024}, {from: 1350, to: 360, rate: 0}}
+	if len(ws) != len(want) || ws[0] != want[0] || ws[1] != want[1] {
+		t.Errorf("parseRateSchedule: test failed. got: %v. want: %v", ws, want)
+	}
+	for _, bad := range []string{"09:00=1M", "9-18=1M", "09:00-18:00", "09:00-25:00=1M"} {
+		if _, err = parseRateSchedule(bad); err == nil {
+			t.Errorf("parseRateSchedule: test failed. want an error for %s", bad)
+		}
+	}
+
+	minutes := []struct {
+		minute int
+		in     []bool
+	}{
+		{minute: 0, in: []bool{false, true}},
+		{minute: 540, in: []bool{true, false}},
+		{minute: 1079, in: []bool{true, false}},
+		{minute: 1080, in: []bool{false, false}},
+		{minute: 1350, in: []bool{false, true}},
+	}
+	for _, m := range minutes {
+		for i, w := range ws {
+			if w.contains(m.minute) != m.in[i] {
+				t.Errorf("rateWindow.contains: test failed for %v and minute %d. want: %v", w, m.minute, m.in[i])
+			}
+		}
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Date(2018, 9, 13, 12, 0, 0, 0, time.UTC)
+	l := &rateLimiter{rate: 1000, now: func() time.Time { return now }}
+	if d := l.reserve(1000); d != 0 {
+		t.Errorf("rateLimiter.reserve: test failed. got: %v. want: 0", d)
+	}
+	if d := l.reserve(500); d != 500*time.Millisecond {
+		t.Errorf("rateLimiter.reserve: test failed. got: %v. want: %v", d, 500*time.Millisecond)
+	}
+	now = now.Add(1500 * time.Millisecond)
+	if d := l.reserve(1000); d != 0 {
+		t.Errorf("rateLimiter.reserve: test failed. got: %v. want: 0", d)
+	}
+	if d := l.reserve(1000); d != time.Second {
+		t.Errorf("rateLimiter.reserve: test failed. got: %v. want: %v", d, time.Second)
+	}
+
+	l.schedule = []rateWindow{{from: 11 * 60, to: 13 * 60, rate: 0}}
+	if d := l.reserve(1 << 20); d != 0 {
+		t.Errorf("rateLimiter.reserve: schedule without limit must not block. got: %v", d)
+	}
+}
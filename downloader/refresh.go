@@ -0,0 +1,139 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+)
+
+// renewInterval is the minimum time between renewals of a playlist. A segment which is still
+// forbidden right after a renewal is not renewed again
+const renewInterval = 10 * time.Second
+
+// playlistRefresher re-acquires a media playlist when signed segment URLs expire
+// and remaps segments to the fresh URLs
+type playlistRefresher struct {
+	mu sync.Mutex
+	// relink returns a freshly signed media playlist link
+	relink func() (string, error)
+	// gen is incremented on every renewal
+	gen        int
+	bySequence map[int]segment
+	byName     map[string]segment
+	renewed    time.Time
+	now        func() time.Time
+}
+
+func newPlaylistRefresher(relink func() (string, error)) *playlistRefresher {
+	return &playlistRefresher{relink: relink, now: time.Now}
+}
+
+// relinkByQuality returns relink function that chooses the same quality from a fresh list of playlists
+func relinkByQuality(list func() ([]playlistInfo, error), quality string) func() (string, error) {
+	return func() (string, error) {
+		pi, err := list()
+		if err != nil {
+			return "", err
+		}
+		link, ok := checkListByQuality(pi, quality)
+		if !ok {
+			return "", fmt.Errorf("relinkByQuality: no %s quality in the renewed list", quality)
+		}
+		return link, nil
+	}
+}
+
+// isAuthExpired checks if the server refused a request because its signature expired
+func isAuthExpired(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// latest returns the segment from the newest playlist if it was renewed after gen
+func (pr *playlistRefresher) latest(seg segment, gen int) (segment, int) {
+	if pr == nil {
+		return seg, gen
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	if gen == pr.gen {
+		return seg, gen
+	}
+	if s, ok := pr.lookup(seg); ok {
+		return s, pr.gen
+	}
+	return seg, gen
+}
+
+// renew fetches a fresh playlist unless another worker did it already after gen
+// and returns the segment from it
+func (pr *playlistRefresher) renew(seg segment, gen int) (segment, int, error) {
+	if pr == nil || pr.relink == nil {
+		return seg, gen, errors.New("renew: playlist cannot be renewed")
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	if gen == pr.gen {
+		if pr.gen > 0 && pr.now().Sub(pr.renewed) < renewInterval {
+			return seg, gen, fmt.Errorf("renew: segment %d is forbidden right after renewal", seg.sequence)
+		}
+		if err := pr.fetch(); err != nil {
+			return seg, gen, err
+		}
+	}
+	s, ok := pr.lookup(seg)
+	if !ok {
+		return seg, gen, fmt.Errorf("renew: no segment %d in the renewed playlist", seg.sequence)
+	}
+	return s, pr.gen, nil
+}
+
+func (pr *playlistRefresher) fetch() error {
+	link, err := pr.relink()
+	if err != nil {
+		return fmt.Errorf("renew: cannot get new playlist link. %s", err.Error())
+	}
+	logger.Info("playlist renewed", "url", link)
+	base, data, err := fetchPlaylist(link)
+	if err != nil {
+		return fmt.Errorf("renew: %s", err.Error())
+	}
+	mp, err := parseMediaPlaylist(base, data)
+	if err != nil {
+		return fmt.Errorf("renew: %s", err.Error())
+	}
+	pr.bySequence = make(map[int]segment, len(mp.segments))
+	pr.byName = make(map[string]segment, len(mp.segments))
+	for _, s := range mp.segments {
+		pr.bySequence[s.sequence] = s
+		pr.byName[segmentName(s.uri)] = s
+	}
+	pr.gen++
+	pr.renewed = pr.now()
+	return nil
+}
+
+// lookup finds the segment in the renewed playlist by its file name and sequence number.
+// Signed paths may change file names, then the sequence number is enough
+func (pr *playlistRefresher) lookup(seg segment) (segment, bool) {
+	bySeq, seqOK := pr.bySequence[seg.sequence]
+	if seqOK && segmentName(bySeq.uri) == segmentName(seg.uri) {
+		return bySeq, true
+	}
+	if s, ok := pr.byName[segmentName(seg.uri)]; ok {
+		return s, true
+	}
+	return bySeq, seqOK
+}
+
+// segmentName returns the file name of the segment without query, e.g. 12.ts
+func segmentName(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	return path.Base(u.Path)
+}
@@ -0,0 +1,84 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPlaylistRefresher(t *testing.T) {
+	var relinks int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sig := r.URL.Query().Get("sig")
+		fmt.Fprintf(w, "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:5\n#EXTINF:10,\n5.ts?sig=%s\n#EXTINF:10,\n6.ts?sig=%s\n#EXT-X-ENDLIST\n", sig, sig)
+	}))
+	defer srv.Close()
+
+	pr := newPlaylistRefresher(func() (string, error) {
+		n := atomic.AddInt32(&relinks, 1)
+		return fmt.Sprintf("%s/index.m3u8?sig=%d", srv.URL, n), nil
+	})
+	old := segment{uri: srv.URL + "/6.ts?sig=0", sequence: 6}
+
+	if got, gen := pr.latest(old, 0); got.uri != old.uri || gen != 0 {
+		t.Errorf("latest: test failed. got: %s, %d. want: %s, 0", got.uri, gen, old.uri)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, gen, err := pr.renew(old, 0)
+			want := srv.URL + "/6.ts?sig=1"
+			if err != nil || got.uri != want || gen != 1 {
+				t.Errorf("renew: test failed. got: %s, %d, %v. want: %s, 1", got.uri, gen, err, want)
+			}
+		}()
+	}
+	wg.Wait()
+	if relinks != 1 {
+		t.Errorf("renew: test failed. playlist was renewed %d times. want: 1", relinks)
+	}
+
+	if got, gen := pr.latest(segment{uri: srv.URL + "/5.ts?sig=0", sequence: 5}, 0); got.uri != srv.URL+"/5.ts?sig=1" || gen != 1 {
+		t.Errorf("latest: test failed. got: %s, %d. want: %s, 1", got.uri, gen, srv.URL+"/5.ts?sig=1")
+	}
+
+	// still forbidden right after renewal
+	if _, _, err := pr.renew(segment{uri: srv.URL + "/6.ts?sig=1", sequence: 6}, 1); err == nil {
+		t.Errorf("renew: test failed. renewed again right after renewal")
+	}
+	pr.now = func() time.Time { return time.Now().Add(renewInterval) }
+	if got, gen, err := pr.renew(segment{uri: srv.URL + "/6.ts?sig=1", sequence: 6}, 1); err != nil || gen != 2 || got.uri != srv.URL+"/6.ts?sig=2" {
+		t.Errorf("renew: test failed. got: %s, %d, %v. want: %s, 2", got.uri, gen, err, srv.URL+"/6.ts?sig=2")
+	}
+	if _, _, err := pr.renew(segment{uri: srv.URL + "/7.ts", sequence: 7}, 2); err == nil {
+		t.Errorf("renew: test failed. found segment missing in the playlist")
+	}
+
+	var nilPR *playlistRefresher
+	if _, _, err := nilPR.renew(old, 0); err == nil {
+		t.Errorf("renew: test failed. nil refresher renewed the playlist")
+	}
+}
+
+func TestSegmentName(t *testing.T) {
+	cases := []struct {
+		input, want string
+	}{
+		{input: "https://example.com/chunked/12.ts", want: "12.ts"},
+		{input: "https://example.com/chunked/12.ts?sig=abc&token=def", want: "12.ts"},
+		{input: "13-muted.ts", want: "13-muted.ts"},
+	}
+	for _, c := range cases {
+		got := segmentName(c.input)
+		if got != c.want {
+			t.Errorf("segmentName: test failed. got: %s. want: %s", got, c.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/zerospiel/ttvldr/internal/helix"
+)
+
+const twitchChannelURL = "https://www.twitch.tv/"
+
+// streamer is the channel of a VOD
+type streamer struct {
+	ID              string `json:"id"`
+	Login           string `json:"login"`
+	DisplayName     string `json:"display_name"`
+	ProfileURL      string `json:"profile_url"`
+	ProfileImageURL string `json:"profile_image_url"`
+}
+
+// streamers caches user lookups, so every streamer is requested once per run
+var streamers = struct {
+	sync.Mutex
+	byID map[string]*streamer
+}{byID: map[string]*streamer{}}
+
+// getStreamer looks up the user by ID via Helix API
+func getStreamer(userID string) (*streamer, error) {
+	streamers.Lock()
+	defer streamers.Unlock()
+	if s, ok := streamers.byID[userID]; ok {
+		return s, nil
+	}
+	users, err := newHelixClient().GetUsers(context.Background(), []string{userID}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("getStreamer: cannot retrieve user via API. %w", err)
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("getStreamer: no user with ID %s", userID)
+	}
+	u := users[0]
+	s := &streamer{
+		ID:              u.ID,
+		Login:           u.Login,
+		DisplayName:     u.DisplayName,
+		ProfileURL:      twitchChannelURL + u.Login,
+		ProfileImageURL: u.ProfileImageURL,
+	}
+	streamers.byID[userID] = s
+	return s, nil
+}
+
+// streamerOfVideo is the streamer as described by the video itself
+func streamerOfVideo(vi *helix.Video) *streamer {
+	s := &streamer{ID: vi.UserID, Login: vi.UserLogin, DisplayName: vi.UserName}
+	if s.Login != "" {
+		s.ProfileURL = twitchChannelURL + s.Login
+	}
+	return s
+}
+
+// resolveStreamer looks up the streamer of the video and fills its login and display name if they are missing.
+// If the lookup fails, the streamer is built from the video
+func resolveStreamer(vi *helix.Video) *streamer {
+	if vi.UserID == "" {
+		return streamerOfVideo(vi)
+	}
+	s, err := getStreamer(vi.UserID)
+	if err != nil {
+		logger.Warn("streamer lookup failed", "user_id", vi.UserID, "err", err)
+		return streamerOfVideo(vi)
+	}
+	if vi.UserLogin == "" {
+		vi.UserLogin = s.Login
+	}
+	if vi.UserName == "" {
+		vi.UserName = s.DisplayName
+	}
+	return s
+}
+
+// String is the streamer in -info output
+func (s *streamer) String() string {
+	switch {
+	case s.Login == "":
+		return "ID " + s.ID
+	case s.DisplayName == "":
+		return s.Login
+	case strings.EqualFold(s.DisplayName, s.Login):
+		return s.DisplayName
+	}
+	return fmt.Sprintf("%s (%s)", s.DisplayName, s.Login)
+}
@@ -0,0 +1,67 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/zerospiel/ttvldr/internal/helix"
+)
+
+func TestResolveStreamer(t *testing.T) {
+	defer func(baseURL, secret string) {
+		helixBaseURL, HelixClientSecret = baseURL, secret
+		streamers.byID = map[string]*streamer{}
+	}(helixBaseURL, HelixClientSecret)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.FormValue("id") != "116245074" {
+			fmt.Fprint(w, `{"data":[]}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":[{"id":"116245074","login":"foo_bar","display_name":"Foo","profile_image_url":"https://cdn/foo.png"}]}`)
+	}))
+	defer srv.Close()
+	helixBaseURL, HelixClientSecret = srv.URL, ""
+	streamers.byID = map[string]*streamer{}
+
+	want := &streamer{ID: "116245074", Login: "foo_bar", DisplayName: "Foo", ProfileURL: "https://www.twitch.tv/foo_bar", ProfileImageURL: "https://cdn/foo.png"}
+	for i := 0; i < 2; i++ {
+		vi := &helix.Video{UserID: "116245074"}
+		got := resolveStreamer(vi)
+		if !reflect.DeepEqual(got, want) || vi.UserLogin != "foo_bar" || vi.UserName != "Foo" {
+			t.Errorf("resolveStreamer: test failed. got: %+v, %s, %s. want: %+v", got, vi.UserLogin, vi.UserName, want)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("resolveStreamer: test failed. lookup was not cached. got %d requests", requests)
+	}
+
+	vi := &helix.Video{UserID: "1", UserLogin: "other", UserName: "Other"}
+	got := resolveStreamer(vi)
+	want = &streamer{ID: "1", Login: "other", DisplayName: "Other", ProfileURL: "https://www.twitch.tv/other"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolveStreamer: test failed for unknown user. got: %+v. want: %+v", got, want)
+	}
+}
+
+func TestStreamerString(t *testing.T) {
+	cases := []struct {
+		input streamer
+		want  string
+	}{
+		{input: streamer{ID: "1", Login: "foo_bar", DisplayName: "Foo"}, want: "Foo (foo_bar)"},
+		{input: streamer{ID: "1", Login: "foo", DisplayName: "FOO"}, want: "FOO"},
+		{input: streamer{ID: "1", Login: "foo"}, want: "foo"},
+		{input: streamer{ID: "1"}, want: "ID 1"},
+	}
+	for _, c := range cases {
+		got := c.input.String()
+		if got != c.want {
+			t.Errorf("streamer.String: test failed. got: %s. want: %s", got, c.want)
+		}
+	}
+}
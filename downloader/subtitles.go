@@ -0,0 +1,173 @@
+package downloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	subtitlesASS      = "ass"
+	subtitlesSRT      = "srt"
+	chatLineDuration  = 6.
+	chatVisibleLines  = 8
+	assDefaultHeaders = `[Script Info]
+ScriptType: v4.00+
+PlayResX: 1280
+PlayResY: 720
+WrapStyle: 0
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Chat,Arial,20,&H00FFFFFF,&H00FFFFFF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,1.5,0,1,20,880,20,1
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+)
+
+var (
+	// Subtitles defines the format chat replay is rendered to: "ass", "srt" or empty for none
+	Subtitles string
+	// MuxSubtitles is a flag that enables muxing rendered chat into the output file as a subtitle stream
+	MuxSubtitles bool
+
+	// the same palette Twitch uses for users without a chosen color
+	chatDefaultColors = []string{
+		"#FF0000", "#0000FF", "#008000", "#B22222", "#FF7F50",
+		"#9ACD32", "#FF4500", "#2E8B57", "#DAA520", "#D2691E",
+		"#5F9EA0", "#1E90FF", "#FF69B4", "#8A2BE2", "#00FF7F",
+	}
+)
+
+// readChat reads chat log previously written by downloadChat
+func readChat(file string) ([]chatMessage, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("readChat: cannot open file %s. %s", file, err.Error())
+	}
+	defer f.Close()
+
+	var msgs []chatMessage
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var m chatMessage
+		if err = dec.Decode(&m); err != nil {
+			return nil, fmt.Errorf("readChat: cannot decode message. %s", err.Error())
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, nil
+}
+
+// renderChat converts chat log into subtitles file of the given format.
+// offset is the position of the first downloaded second in the VOD, so times in subtitles
+// match the beginning of a partial download
+func renderChat(chatFile, file, format string, offset float64) (string, error) {
+	if format != subtitlesASS && format != subtitlesSRT {
+		return "", fmt.Errorf("renderChat: unknown subtitles format %s", format)
+	}
+	msgs, err := readChat(chatFile)
+	if err != nil {
+		return "", err
+	}
+	if len(msgs) == 0 {
+		return "", errors.New("renderChat: chat log is empty")
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return "", fmt.Errorf("renderChat: cannot create file %s. %s", file, err.Error())
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if format == subtitlesASS {
+		writeASS(w, msgs, offset)
+	} else {
+		writeSRT(w, msgs, offset)
+	}
+	if err = w.Flush(); err != nil {
+		return "", fmt.Errorf("renderChat: cannot write file %s. %s", file, err.Error())
+	}
+	return file, nil
+}
+
+// writeSRT writes every message as a separate cue; players stack overlapping cues on their own
+func writeSRT(w io.Writer, msgs []chatMessage, offset float64) {
+	n := 0
+	for _, m := range msgs {
+		start := m.Offset - offset
+		if start < 0 {
+			continue
+		}
+		n++
+		fmt.Fprintf(w, "%d\n%s --> %s\n<font color=\"%s\">%s</font>: %s\n\n", n, srtTime(start), srtTime(start+chatLineDuration), chatUserColor(m.User), chatUserName(m.User), m.Body)
+	}
+}
+
+// writeASS writes a chat box in the bottom left corner: every new message pushes older ones up
+// and messages disappear after chatLineDuration or when the box is full
+func writeASS(w io.Writer, msgs []chatMessage, offset float64) {
+	io.WriteString(w, assDefaultHeaders)
+	lines := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		lines = append(lines, fmt.Sprintf("{\\c%s}%s{\\c&HFFFFFF&}: %s", assColor(chatUserColor(m.User)), assEscape(chatUserName(m.User)), assEscape(m.Body)))
+	}
+	for i, m := range msgs {
+		start := m.Offset - offset
+		if start < 0 {
+			continue
+		}
+		end := start + chatLineDuration
+		if i+1 < len(msgs) && msgs[i+1].Offset-offset < end {
+			end = msgs[i+1].Offset - offset
+		}
+		first := i
+		for first > 0 && i-first+1 < chatVisibleLines && m.Offset-msgs[first-1].Offset < chatLineDuration && msgs[first-1].Offset >= offset {
+			first--
+		}
+		fmt.Fprintf(w, "Dialogue: 0,%s,%s,Chat,,0,0,0,,%s\n", assTime(start), assTime(end), strings.Join(lines[first:i+1], "\\N"))
+	}
+}
+
+func chatUserName(u chatUser) string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Login
+}
+
+func chatUserColor(u chatUser) string {
+	if len(u.Color) == 7 && u.Color[0] == '#' {
+		return strings.ToUpper(u.Color)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(u.Login))
+	return chatDefaultColors[h.Sum32()%uint32(len(chatDefaultColors))]
+}
+
+// assColor converts #RRGGBB to &HBBGGRR&
+func assColor(c string) string {
+	return "&H" + c[5:7] + c[3:5] + c[1:3] + "&"
+}
+
+func assEscape(s string) string {
+	// ASS has no escaping for a backslash, so it's broken with a zero-width space
+	r := strings.NewReplacer("\\", "\\\u200b", "{", "\\{", "}", "\\}", "\n", " ")
+	return r.Replace(s)
+}
+
+func srtTime(sec float64) string {
+	ms := int(sec*1000 + .5)
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+func assTime(sec float64) string {
+	cs := int(sec*100 + .5)
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
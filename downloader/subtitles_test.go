@@ -0,0 +1,65 @@
+package downloader
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var testChat = []chatMessage{
+	{Offset: 10, User: chatUser{Login: "foo", DisplayName: "Foo", Color: "#ff8000"}, Body: "first"},
+	{Offset: 12.25, User: chatUser{Login: "bar"}, Body: "second {\\b1}"},
+	{Offset: 30, User: chatUser{Login: "baz", DisplayName: "Baz", Color: "#00FF00"}, Body: "third"},
+}
+
+func TestWriteSRT(t *testing.T) {
+	buf := bytes.NewBufferString("")
+	writeSRT(buf, testChat, 11)
+	want := "1\n00:00:01,250 --> 00:00:07,250\n<font color=\"" + chatUserColor(testChat[1].User) + "\">bar</font>: second {\\b1}\n\n" +
+		"2\n00:00:19,000 --> 00:00:25,000\n<font color=\"#00FF00\">Baz</font>: third\n\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeSRT: test failed. got: %q. want: %q", got, want)
+	}
+}
+
+func TestWriteASS(t *testing.T) {
+	buf := bytes.NewBufferString("")
+	writeASS(buf, testChat, 0)
+	got := buf.String()
+	if !strings.HasPrefix(got, "[Script Info]") {
+		t.Errorf("writeASS: test failed. no headers in output: %q", got)
+	}
+	events := strings.Split(strings.TrimSpace(got[strings.Index(got, "Dialogue:"):]), "\n")
+	want := []string{
+		"Dialogue: 0,0:00:10.00,0:00:12.25,Chat,,0,0,0,,{\\c&H0080FF&}Foo{\\c&HFFFFFF&}: first",
+		"Dialogue: 0,0:00:12.25,0:00:18.25,Chat,,0,0,0,,{\\c&H0080FF&}Foo{\\c&HFFFFFF&}: first\\N{\\c" + assColor(chatUserColor(testChat[1].User)) + "}bar{\\c&HFFFFFF&}: second \\{\\\u200bb1\\}",
+		"Dialogue: 0,0:00:30.00,0:00:36.00,Chat,,0,0,0,,{\\c&H00FF00&}Baz{\\c&HFFFFFF&}: third",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("writeASS: test failed. got %d events: %q. want: %d", len(events), events, len(want))
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("writeASS: test failed. got: %q. want: %q", events[i], want[i])
+		}
+	}
+}
+
+func TestSubtitlesTime(t *testing.T) {
+	cases := []struct {
+		input   float64
+		srt, as string
+	}{
+		{input: 0, srt: "00:00:00,000", as: "0:00:00.00"},
+		{input: 61.5, srt: "00:01:01,500", as: "0:01:01.50"},
+		{input: 3723.004, srt: "01:02:03,004", as: "1:02:03.00"},
+	}
+	for _, c := range cases {
+		if got := srtTime(c.input); got != c.srt {
+			t.Errorf("srtTime: test failed. got: %s. want: %s", got, c.srt)
+		}
+		if got := assTime(c.input); got != c.as {
+			t.Errorf("assTime: test failed. got: %s. want: %s", got, c.as)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	gqlAPI    = "https://gql.twitch.tv/gql"
+	gqlClient = "kimne78kx3ncx6brgo4mv6wki5h1ko"
+	gqlQuery  = `query PlaybackAccessToken($vodID: ID!, $playerType: String!) {
+	videoPlaybackAccessToken(id: $vodID, params: {platform: "web", playerBackend: "mediaplayer", playerType: $playerType}) {
+		value
+		signature
+	}
+}`
+)
+
+// TokenProvider gets access token and its signature that Usher API requires to give VOD playlists
+type TokenProvider interface {
+	// Name is a short name of the provider used in flags and error messages
+	Name() string
+	// Token returns access token and signature for the given VOD
+	Token(vodID string) (token string, sig string, err error)
+}
+
+// TokenProviders are tried one by one until any of them returns a token
+var TokenProviders = []TokenProvider{GQLTokenProvider{}, LegacyTokenProvider{}}
+
+// TokenProvidersByName returns known providers in the given order
+func TokenProvidersByName(names []string) ([]TokenProvider, error) {
+	known := []TokenProvider{GQLTokenProvider{}, LegacyTokenProvider{}}
+	tp := make([]TokenProvider, 0, len(names))
+LOOP:
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		for _, k := range known {
+			if k.Name() == n {
+				tp = append(tp, k)
+				continue LOOP
+			}
+		}
+		return nil, fmt.Errorf("TokenProvidersByName: unknown token provider %s", n)
+	}
+	return tp, nil
+}
+
+// tokenError keeps errors of every provider that was tried
+type tokenError struct {
+	names []string
+	errs  []error
+}
+
+func (e *tokenError) Error() string {
+	buf := bytes.NewBufferString("getToken: no token provider succeeded")
+	for i := range e.errs {
+		fmt.Fprintf(buf, "; %s: %s", e.names[i], e.errs[i].Error())
+	}
+	return buf.String()
+}
+
+func (e *tokenError) Unwrap() []error {
+	return e.errs
+}
+
+func getToken(vodID string) (token string, sig string, err error) {
+	te := &tokenError{}
+	for _, tp := range TokenProviders {
+		token, sig, err = tp.Token(vodID)
+		if err == nil {
+			logger.Debug("got access token", "provider", tp.Name(), "token", token, "sig", sig)
+			if rb := restrictedBitrates(token); len(rb) > 0 {
+				logger.Info("qualities are restricted for this account", "qualities", rb)
+			}
+			return token, sig, nil
+		}
+		logger.Debug("token provider failed", "provider", tp.Name(), "err", err)
+		te.names, te.errs = append(te.names, tp.Name()), append(te.errs, err)
+	}
+	if len(te.errs) == 0 {
+		return "", "", fmt.Errorf("getToken: no token providers are set")
+	}
+	return "", "", te
+}
+
+// restrictedBitrates returns qualities that are unavailable with the given access token
+func restrictedBitrates(token string) []string {
+	var t struct {
+		Chansub struct {
+			RestrictedBitrates []string `json:"restricted_bitrates"`
+		} `json:"chansub"`
+	}
+	if err := json.Unmarshal([]byte(token), &t); err != nil {
+		return nil
+	}
+	return t.Chansub.RestrictedBitrates
+}
+
+// GQLTokenProvider gets token with PlaybackAccessToken query of Twitch GraphQL API the web player uses
+type GQLTokenProvider struct{}
+
+// Name implements TokenProvider
+func (GQLTokenProvider) Name() string {
+	return "gql"
+}
+
+// Token implements TokenProvider
+func (GQLTokenProvider) Token(vodID string) (token string, sig string, err error) {
+	resp, err := postGQL("PlaybackAccessToken", gqlQuery, map[string]string{
+		"vodID":      vodID,
+		"playerType": "embed",
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("GQLTokenProvider: cannot get token. %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Data struct {
+			VideoPlaybackAccessToken *struct {
+				Value     string `json:"value"`
+				Signature string `json:"signature"`
+			} `json:"videoPlaybackAccessToken"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	if err != nil {
+		return "", "", fmt.Errorf("GQLTokenProvider: cannot decode data. %s", err.Error())
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return "", "", fmt.Errorf("GQLTokenProvider: %w. %s", errBadOAuthToken, data.Message)
+	case resp.StatusCode != http.StatusOK:
+		return "", "", fmt.Errorf("GQLTokenProvider: server responded with %d code. %s %s", resp.StatusCode, data.Error, data.Message)
+	case len(data.Errors) > 0:
+		return "", "", fmt.Errorf("GQLTokenProvider: query failed. %s", data.Errors[0].Message)
+	case data.Data.VideoPlaybackAccessToken == nil:
+		return "", "", fmt.Errorf("GQLTokenProvider: %w. No token in response", errVODRestricted)
+	}
+	return data.Data.VideoPlaybackAccessToken.Value, data.Data.VideoPlaybackAccessToken.Signature, nil
+}
+
+// postGQL sends the query to GQL API with the Client-ID of the web player and OAuthToken, if it's set
+func postGQL(operation, query string, variables interface{}) (*http.Response, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"operationName": operation,
+		"query":         query,
+		"variables":     variables,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("postGQL: cannot encode query. %s", err.Error())
+	}
+	logger.Debug("requesting GQL API", "url", gqlAPI, "operation", operation)
+	req, err := newRequest("POST", gqlAPI, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("postGQL: cannot create request. %s", err.Error())
+	}
+	req.Header.Set("Client-ID", gqlClient)
+	req.Header.Set("Content-Type", "application/json")
+	if OAuthToken != "" {
+		req.Header.Set("Authorization", "OAuth "+OAuthToken)
+	}
+	return doRequest(req, HTTP.RequestTimeout)
+}
+
+// LegacyTokenProvider gets token with deprecated api/vods/<id>/access_token endpoint
+type LegacyTokenProvider struct{}
+
+// Name implements TokenProvider
+func (LegacyTokenProvider) Name() string {
+	return "legacy"
+}
+
+// Token implements TokenProvider
+func (LegacyTokenProvider) Token(vodID string) (token string, sig string, err error) {
+	twitchAPIv2 := replaceVODID(oldAPIGetVideo, vodID)
+	twitchAPIv2 += twitchClient
+	logger.Debug("requesting v2 API", "url", twitchAPIv2)
+	req, err := newRequest("GET", twitchAPIv2, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("LegacyTokenProvider: cannot create request. %s", err.Error())
+	}
+	if OAuthToken != "" {
+		req.Header.Set("Authorization", "OAuth "+OAuthToken)
+	}
+	resp, err := doRequest(req, HTTP.RequestTimeout)
+	if err != nil {
+		return "", "", fmt.Errorf("LegacyTokenProvider: cannot get twitch API v2 token. %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Token   string `json:"token"`
+		Sig     string `json:"sig"`
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	if err != nil {
+		return "", "", fmt.Errorf("LegacyTokenProvider: cannot decode data. %s", err.Error())
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return "", "", fmt.Errorf("LegacyTokenProvider: %w. %s", errBadOAuthToken, data.Message)
+	case resp.StatusCode == http.StatusForbidden:
+		return "", "", fmt.Errorf("LegacyTokenProvider: %w. %s", errVODRestricted, data.Message)
+	case resp.StatusCode != http.StatusOK:
+		return "", "", fmt.Errorf("LegacyTokenProvider: server responded with %d code. %s %s", resp.StatusCode, data.Error, data.Message)
+	}
+	return data.Token, data.Sig, nil
+}
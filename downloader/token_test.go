@@ -0,0 +1,61 @@
+package downloader
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fakeTokenProvider struct {
+	name       string
+	token, sig string
+	err        error
+}
+
+func (f fakeTokenProvider) Name() string {
+	return f.name
+}
+
+func (f fakeTokenProvider) Token(string) (string, string, error) {
+	return f.token, f.sig, f.err
+}
+
+func TestGetTokenFallback(t *testing.T) {
+	defer func(tp []TokenProvider) { TokenProviders = tp }(TokenProviders)
+
+	TokenProviders = []TokenProvider{
+		fakeTokenProvider{name: "first", err: errors.New("endpoint is gone")},
+		fakeTokenProvider{name: "second", token: "tok", sig: "sig"},
+	}
+	token, sig, err := getToken(vodID)
+	if err != nil || token != "tok" || sig != "sig" {
+		t.Errorf("getToken: test failed. got: %s %s. err: %v", token, sig, err)
+	}
+
+	TokenProviders = []TokenProvider{
+		fakeTokenProvider{name: "first", err: errors.New("endpoint is gone")},
+		fakeTokenProvider{name: "second", err: errVODRestricted},
+	}
+	_, _, err = getToken(vodID)
+	if err == nil {
+		t.Fatalf("getToken: test failed. want an error")
+	}
+	for _, want := range []string{"first: endpoint is gone", "second: " + errVODRestricted.Error()} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("getToken: test failed. error %q does not contain %q", err.Error(), want)
+		}
+	}
+	if !errors.Is(err, errVODRestricted) {
+		t.Errorf("getToken: test failed. error %q must wrap errVODRestricted", err.Error())
+	}
+}
+
+func TestTokenProvidersByName(t *testing.T) {
+	tp, err := TokenProvidersByName([]string{"legacy", " gql"})
+	if err != nil || len(tp) != 2 || tp[0].Name() != "legacy" || tp[1].Name() != "gql" {
+		t.Errorf("TokenProvidersByName: test failed. got: %v. err: %v", tp, err)
+	}
+	if _, err = TokenProvidersByName([]string{"gql", "foo"}); err == nil {
+		t.Errorf("TokenProvidersByName: test failed. want an error for unknown provider")
+	}
+}
@@ -0,0 +1,168 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Transcode is a name of transcoding profile applied to the output file, see transcodeProfiles.
+// Empty means stream copy without transcoding
+var Transcode string
+
+// transcodeProfile is a set of ffmpeg encoding options
+type transcodeProfile struct {
+	// args select streams and set their codecs
+	args []string
+	// mp4Args are added for MP4 output
+	mp4Args []string
+	// audio profiles drop video and write ext files in format instead of the container
+	audio       bool
+	ext, format string
+}
+
+// transcodeProfiles are CPU encoding profiles. Video profiles encode only the main video stream
+// and copy audio, subtitles and cover art
+var transcodeProfiles = map[string]transcodeProfile{
+	"h264-crf23-medium": {
+		args: []string{"-map", "0", "-c", "copy", "-c:v:0", "libx264", "-crf", "23", "-preset", "medium"},
+	},
+	"h264-crf28-veryfast": {
+		args: []string{"-map", "0", "-c", "copy", "-c:v:0", "libx264", "-crf", "28", "-preset", "veryfast"},
+	},
+	"h265-crf28-slow": {
+		args: []string{"-map", "0", "-c", "copy", "-c:v:0", "libx265", "-crf", "28", "-preset", "slow"},
+		// QuickTime and Apple devices play HEVC in MP4 only with hvc1 tag
+		mp4Args: []string{"-tag:v:0", "hvc1"},
+	},
+	"audio-opus-96k": {
+		args:   []string{"-map", "0:a:0", "-vn", "-c:a", "libopus", "-b:a", "96k"},
+		audio:  true,
+		ext:    "opus",
+		format: "opus",
+	},
+}
+
+// TranscodeProfiles returns names of transcoding profiles
+func TranscodeProfiles() []string {
+	names := make([]string, 0, len(transcodeProfiles))
+	for name := range transcodeProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ffmpegTranscodeArgs returns ffmpeg arguments which make it write progress into stdout
+func ffmpegTranscodeArgs(in, out string, p transcodeProfile) []string {
+	args := append([]string{"-i", in}, p.args...)
+	format := p.format
+	if format == "" {
+		format = ffmpegFormat()
+		if format == containerMP4 {
+			args = append(args, p.mp4Args...)
+		}
+	}
+	return append(args, "-progress", "pipe:1", "-nostats", "-f", format, out)
+}
+
+// transcodeFile encodes in into out with the Transcode profile and shows progress of the duration in seconds.
+// ffmpeg writes into out.part, which is renamed when it's done
+func transcodeFile(in, out string, duration float64) error {
+	p, ok := transcodeProfiles[Transcode]
+	if !ok {
+		return fmt.Errorf("transcodeFile: unknown profile %s", Transcode)
+	}
+	partFile := out + partExtension
+	args := ffmpegTranscodeArgs(in, partFile, p)
+	logger.Debug("running ffmpeg", "args", args)
+	cmd := exec.Command(ffmpegBinary, args...)
+	cmdErr := bytes.NewBuffer(nil)
+	cmd.Stderr = cmdErr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("transcodeFile: %s", err.Error())
+	}
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("transcodeFile: could not start ffmpeg. %s", err.Error())
+	}
+	readProgress(stdout, func(pr transcodeProgress) {
+		if duration > 0 {
+			fmt.Printf("\rTranscoding: %5.1f%% speed %s", pr.percent(duration), pr.speed)
+		}
+	})
+	if duration > 0 {
+		fmt.Println()
+	}
+	if err = cmd.Wait(); err != nil {
+		os.Remove(partFile)
+		return fmt.Errorf("transcodeFile: ffmpeg returned error while transcoding: %s", lastLines(cmdErr.String(), 5))
+	}
+	if err = os.Rename(partFile, out); err != nil {
+		return fmt.Errorf("transcodeFile: could not rename %s. %s", partFile, err.Error())
+	}
+	return nil
+}
+
+// transcodeProgress is a block of ffmpeg -progress output
+type transcodeProgress struct {
+	// outTime is position in the output in microseconds
+	outTime int64
+	speed   string
+	end     bool
+}
+
+func (p transcodeProgress) percent(duration float64) float64 {
+	pc := float64(p.outTime) / 1e6 / duration * 100
+	switch {
+	case p.end || pc > 100:
+		return 100
+	case pc < 0:
+		return 0
+	}
+	return pc
+}
+
+// readProgress parses key=value lines of ffmpeg -progress output and calls report after every block,
+// which ends with progress=continue or progress=end
+func readProgress(r io.Reader, report func(transcodeProgress)) {
+	var p transcodeProgress
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		i := strings.IndexByte(sc.Text(), '=')
+		if i < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(sc.Text()[:i]), strings.TrimSpace(sc.Text()[i+1:])
+		switch key {
+		// out_time_ms is in microseconds too
+		case "out_time_us", "out_time_ms":
+			if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+				p.outTime = v
+			}
+		case "speed":
+			p.speed = value
+		case "progress":
+			p.end = value == "end"
+			report(p)
+		}
+	}
+	// ffmpeg must not block on a full pipe if the scanner stopped on a too long line
+	io.Copy(ioutil.Discard, r)
+}
+
+// lastLines returns the last n lines of s, ffmpeg prints the reason of the error at the end
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,89 @@
+package downloader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFFMpegTranscodeArgs(t *testing.T) {
+	defer func(c string) { Container = c }(Container)
+	cases := []struct {
+		profile   string
+		container string
+		want      []string
+	}{
+		{"h264-crf23-medium", containerMP4, []string{"-i", "in.mp4", "-map", "0", "-c", "copy", "-c:v:0", "libx264", "-crf", "23", "-preset", "medium", "-progress", "pipe:1", "-nostats", "-f", "mp4", "out.mp4.part"}},
+		{"h265-crf28-slow", containerMP4, []string{"-i", "in.mp4", "-map", "0", "-c", "copy", "-c:v:0", "libx265", "-crf", "28", "-preset", "slow", "-tag:v:0", "hvc1", "-progress", "pipe:1", "-nostats", "-f", "mp4", "out.mp4.part"}},
+		{"h265-crf28-slow", containerMKV, []string{"-i", "in.mp4", "-map", "0", "-c", "copy", "-c:v:0", "libx265", "-crf", "28", "-preset", "slow", "-progress", "pipe:1", "-nostats", "-f", "matroska", "out.mp4.part"}},
+		{"audio-opus-96k", containerMP4, []string{"-i", "in.mp4", "-map", "0:a:0", "-vn", "-c:a", "libopus", "-b:a", "96k", "-progress", "pipe:1", "-nostats", "-f", "opus", "out.mp4.part"}},
+	}
+	for _, c := range cases {
+		Container = c.container
+		if got := ffmpegTranscodeArgs("in.mp4", "out.mp4.part", transcodeProfiles[c.profile]); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ffmpegTranscodeArgs: test failed. profile: %s. got: %v. want: %v", c.profile, got, c.want)
+		}
+	}
+}
+
+func TestTranscodeExtension(t *testing.T) {
+	defer func(tr, c string, a bool) { Transcode, Container, AudioOnly = tr, c, a }(Transcode, Container, AudioOnly)
+	cases := []struct {
+		transcode string
+		container string
+		audioOnly bool
+		want      string
+	}{
+		{"", containerMKV, false, containerMKV},
+		{"h264-crf23-medium", containerMKV, false, containerMKV},
+		{"audio-opus-96k", containerMP4, false, "opus"},
+		{"audio-opus-96k", containerMP4, true, "opus"},
+	}
+	for _, c := range cases {
+		Transcode, Container, AudioOnly = c.transcode, c.container, c.audioOnly
+		if got := outputExtension(); got != c.want {
+			t.Errorf("outputExtension: test failed. got: %s. want: %s", got, c.want)
+		}
+	}
+}
+
+func TestReadProgress(t *testing.T) {
+	out := `frame=10
+out_time_us=1500000
+out_time_ms=1500000
+out_time=00:00:01.500000
+speed=2.5x
+progress=continue
+bad line
+out_time_us=N/A
+speed=3x
+progress=continue
+out_time_us=4000000
+progress=end
+`
+	var got []transcodeProgress
+	readProgress(strings.NewReader(out), func(p transcodeProgress) { got = append(got, p) })
+	want := []transcodeProgress{
+		{outTime: 1500000, speed: "2.5x"},
+		{outTime: 1500000, speed: "3x"},
+		{outTime: 4000000, speed: "3x", end: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readProgress: test failed. got: %v. want: %v", got, want)
+	}
+
+	cases := []struct {
+		p    transcodeProgress
+		want float64
+	}{
+		{transcodeProgress{outTime: 1500000}, 50},
+		{transcodeProgress{outTime: 4000000}, 100},
+		{transcodeProgress{outTime: 1000000, end: true}, 100},
+		{transcodeProgress{outTime: -1}, 0},
+	}
+	for _, c := range cases {
+		if got := c.p.percent(3); got != c.want {
+			t.Errorf("percent: test failed. got: %v. want: %v", got, c.want)
+		}
+	}
+}
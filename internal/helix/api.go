@@ -0,0 +1,219 @@
+package helix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+)
+
+// maxIDs is the maximum number of IDs and logins in a single request
+const maxIDs = 100
+
+var errTooManyIDs = errors.New("too many IDs, maximum is 100")
+
+// Video is a VOD, highlight or upload
+type Video struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	UserLogin    string    `json:"user_login"`
+	UserName     string    `json:"user_name"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	CreatedAt    time.Time `json:"created_at"`
+	PublishedAt  time.Time `json:"published_at"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	Viewable     string    `json:"viewable"`
+	ViewCount    int       `json:"view_count"`
+	Language     string    `json:"language"`
+	Type         string    `json:"type"`
+	Duration     string    `json:"duration"`
+	// StreamID is empty for uploads and highlights
+	StreamID      string         `json:"stream_id"`
+	MutedSegments []MutedSegment `json:"muted_segments"`
+}
+
+// MutedSegment is a part of the video muted because of copyrighted audio, in seconds
+type MutedSegment struct {
+	Offset   int `json:"offset"`
+	Duration int `json:"duration"`
+}
+
+// VideosQuery selects videos by IDs, by user or by game. Limit is the maximum number of videos, 0 means all of them.
+// After continues the list from a cursor returned before
+type VideosQuery struct {
+	IDs    []string
+	UserID string
+	GameID string
+	// Type is all, archive, highlight or upload
+	Type string
+	// Sort is time, trending or views
+	Sort  string
+	After string
+	Limit int
+}
+
+// GetVideos returns videos and a cursor of the next page, empty if there are no more videos
+func (c *Client) GetVideos(ctx context.Context, vq VideosQuery) ([]Video, string, error) {
+	if len(vq.IDs) > maxIDs {
+		return nil, "", errTooManyIDs
+	}
+	q := url.Values{"id": vq.IDs}
+	setParam(q, "user_id", vq.UserID)
+	setParam(q, "game_id", vq.GameID)
+	setParam(q, "type", vq.Type)
+	setParam(q, "sort", vq.Sort)
+	var videos []Video
+	cursor, err := c.list(ctx, "/videos", q, vq.After, vq.Limit, func(data json.RawMessage) (int, error) {
+		var page []Video
+		err := json.Unmarshal(data, &page)
+		videos = append(videos, page...)
+		return len(page), err
+	})
+	return videos, cursor, err
+}
+
+// User is a Twitch user
+type User struct {
+	ID              string    `json:"id"`
+	Login           string    `json:"login"`
+	DisplayName     string    `json:"display_name"`
+	Type            string    `json:"type"`
+	BroadcasterType string    `json:"broadcaster_type"`
+	Description     string    `json:"description"`
+	ProfileImageURL string    `json:"profile_image_url"`
+	OfflineImageURL string    `json:"offline_image_url"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// GetUsers returns users by IDs and logins, up to 100 of them together
+func (c *Client) GetUsers(ctx context.Context, ids, logins []string) ([]User, error) {
+	if len(ids)+len(logins) > maxIDs {
+		return nil, errTooManyIDs
+	}
+	var data struct {
+		Data []User `json:"data"`
+	}
+	err := c.get(ctx, "/users", url.Values{"id": ids, "login": logins}, &data)
+	return data.Data, err
+}
+
+// Clip is a clip of a stream or VOD
+type Clip struct {
+	ID              string    `json:"id"`
+	URL             string    `json:"url"`
+	EmbedURL        string    `json:"embed_url"`
+	BroadcasterID   string    `json:"broadcaster_id"`
+	BroadcasterName string    `json:"broadcaster_name"`
+	CreatorID       string    `json:"creator_id"`
+	CreatorName     string    `json:"creator_name"`
+	VideoID         string    `json:"video_id"`
+	GameID          string    `json:"game_id"`
+	Language        string    `json:"language"`
+	Title           string    `json:"title"`
+	ViewCount       int       `json:"view_count"`
+	CreatedAt       time.Time `json:"created_at"`
+	ThumbnailURL    string    `json:"thumbnail_url"`
+	// Duration is in seconds
+	Duration float64 `json:"duration"`
+	// VODOffset is the start of the clip in the VOD in seconds, nil if the VOD is not available
+	VODOffset *int `json:"vod_offset"`
+}
+
+// ClipsQuery selects clips by IDs, by broadcaster or by game, optionally created in [StartedAt, EndedAt].
+// Limit is the maximum number of clips, 0 means all of them. After continues the list from a cursor returned before
+type ClipsQuery struct {
+	IDs           []string
+	BroadcasterID string
+	GameID        string
+	StartedAt     time.Time
+	EndedAt       time.Time
+	After         string
+	Limit         int
+}
+
+// GetClips returns clips and a cursor of the next page, empty if there are no more clips
+func (c *Client) GetClips(ctx context.Context, cq ClipsQuery) ([]Clip, string, error) {
+	if len(cq.IDs) > maxIDs {
+		return nil, "", errTooManyIDs
+	}
+	q := url.Values{"id": cq.IDs}
+	setParam(q, "broadcaster_id", cq.BroadcasterID)
+	setParam(q, "game_id", cq.GameID)
+	if !cq.StartedAt.IsZero() {
+		q.Set("started_at", cq.StartedAt.UTC().Format(time.RFC3339))
+	}
+	if !cq.EndedAt.IsZero() {
+		q.Set("ended_at", cq.EndedAt.UTC().Format(time.RFC3339))
+	}
+	var clips []Clip
+	cursor, err := c.list(ctx, "/clips", q, cq.After, cq.Limit, func(data json.RawMessage) (int, error) {
+		var page []Clip
+		err := json.Unmarshal(data, &page)
+		clips = append(clips, page...)
+		return len(page), err
+	})
+	return clips, cursor, err
+}
+
+// Game is a game or a category
+type Game struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	BoxArtURL string `json:"box_art_url"`
+	IGDBID    string `json:"igdb_id"`
+}
+
+// GetGames returns games by IDs and names, up to 100 of them together
+func (c *Client) GetGames(ctx context.Context, ids, names []string) ([]Game, error) {
+	if len(ids)+len(names) > maxIDs {
+		return nil, errTooManyIDs
+	}
+	var data struct {
+		Data []Game `json:"data"`
+	}
+	err := c.get(ctx, "/games", url.Values{"id": ids, "name": names}, &data)
+	return data.Data, err
+}
+
+// Channel is a result of channel search
+type Channel struct {
+	ID                  string   `json:"id"`
+	BroadcasterLogin    string   `json:"broadcaster_login"`
+	DisplayName         string   `json:"display_name"`
+	BroadcasterLanguage string   `json:"broadcaster_language"`
+	GameID              string   `json:"game_id"`
+	GameName            string   `json:"game_name"`
+	Title               string   `json:"title"`
+	IsLive              bool     `json:"is_live"`
+	Tags                []string `json:"tags"`
+	ThumbnailURL        string   `json:"thumbnail_url"`
+	// StartedAt is RFC3339 time of the current stream, empty if the channel is offline
+	StartedAt string `json:"started_at"`
+}
+
+// SearchChannels returns channels matching the query and a cursor of the next page.
+// Limit is the maximum number of channels, 0 means all of them
+func (c *Client) SearchChannels(ctx context.Context, query string, liveOnly bool, after string, limit int) ([]Channel, string, error) {
+	q := url.Values{}
+	q.Set("query", query)
+	if liveOnly {
+		q.Set("live_only", "true")
+	}
+	var channels []Channel
+	cursor, err := c.list(ctx, "/search/channels", q, after, limit, func(data json.RawMessage) (int, error) {
+		var page []Channel
+		err := json.Unmarshal(data, &page)
+		channels = append(channels, page...)
+		return len(page), err
+	})
+	return channels, cursor, err
+}
+
+func setParam(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
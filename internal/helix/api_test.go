@@ -0,0 +1,66 @@
+package helix
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEndpoints(t *testing.T) {
+	var query string
+	c, _, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Path + "?" + r.URL.RawQuery
+		switch r.URL.Path {
+		case "/videos":
+			fmt.Fprint(w, `{"data":[{"id":"309711819","user_login":"foo","created_at":"2018-09-13T21:47:11Z",
+				"muted_segments":[{"offset":120,"duration":30}]}],"pagination":{}}`)
+		case "/users":
+			fmt.Fprint(w, `{"data":[{"id":"1","login":"foo","display_name":"Foo","created_at":"2010-01-02T03:04:05Z"}]}`)
+		case "/clips":
+			fmt.Fprint(w, `{"data":[{"id":"Clip","video_id":"","duration":29.9,"vod_offset":null},{"id":"Clip2","vod_offset":60}]}`)
+		case "/games":
+			fmt.Fprint(w, `{"data":[{"id":"33214","name":"Fortnite","igdb_id":"1905"}]}`)
+		case "/search/channels":
+			fmt.Fprint(w, `{"data":[{"id":"1","broadcaster_login":"foo","is_live":false,"started_at":"","tags":["English"]}]}`)
+		}
+	})
+	defer done()
+	ctx := context.Background()
+
+	videos, _, err := c.GetVideos(ctx, VideosQuery{IDs: []string{"309711819"}})
+	wantVideo := Video{ID: "309711819", UserLogin: "foo", CreatedAt: time.Date(2018, 9, 13, 21, 47, 11, 0, time.UTC),
+		MutedSegments: []MutedSegment{{Offset: 120, Duration: 30}}}
+	if err != nil || len(videos) != 1 || !reflect.DeepEqual(videos[0], wantVideo) || query != "/videos?id=309711819" {
+		t.Errorf("GetVideos: test failed. got: %+v, %v, %s", videos, err, query)
+	}
+
+	users, err := c.GetUsers(ctx, []string{"1"}, []string{"foo"})
+	if err != nil || len(users) != 1 || users[0].DisplayName != "Foo" || users[0].CreatedAt.Year() != 2010 || query != "/users?id=1&login=foo" {
+		t.Errorf("GetUsers: test failed. got: %+v, %v, %s", users, err, query)
+	}
+
+	clips, _, err := c.GetClips(ctx, ClipsQuery{BroadcasterID: "1", StartedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Limit: 2})
+	if err != nil || len(clips) != 2 || clips[0].VODOffset != nil || clips[0].Duration != 29.9 || *clips[1].VODOffset != 60 ||
+		query != "/clips?broadcaster_id=1&first=2&started_at=2020-01-01T00%3A00%3A00Z" {
+		t.Errorf("GetClips: test failed. got: %+v, %v, %s", clips, err, query)
+	}
+
+	games, err := c.GetGames(ctx, nil, []string{"Fortnite"})
+	if err != nil || !reflect.DeepEqual(games, []Game{{ID: "33214", Name: "Fortnite", IGDBID: "1905"}}) || query != "/games?name=Fortnite" {
+		t.Errorf("GetGames: test failed. got: %+v, %v, %s", games, err, query)
+	}
+
+	channels, cursor, err := c.SearchChannels(ctx, "foo bar", true, "", 0)
+	if err != nil || len(channels) != 1 || channels[0].BroadcasterLogin != "foo" || cursor != "" ||
+		query != "/search/channels?first=100&live_only=true&query=foo+bar" {
+		t.Errorf("SearchChannels: test failed. got: %+v, %q, %v, %s", channels, cursor, err, query)
+	}
+
+	if _, err = c.GetUsers(ctx, strings.Split(strings.Repeat("1,", 100), ","), nil); err != errTooManyIDs {
+		t.Errorf("GetUsers: test failed. got: %v. want: %v", err, errTooManyIDs)
+	}
+}
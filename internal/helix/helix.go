@@ -0,0 +1,334 @@
+// Package helix is a small client of Twitch Helix API
+package helix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// BaseURL is the root of Helix API
+	BaseURL = "https://api.twitch.tv/helix"
+	// TokenURL is the OAuth endpoint of app access tokens
+	TokenURL = "https://id.twitch.tv/oauth2/token"
+
+	// maxPageSize is the maximum of the first parameter of paginated endpoints
+	maxPageSize = 100
+	// maxRetries limits retries of requests rejected by rate limit
+	maxRetries = 3
+	// defaultRetryDelay is used on 429 response without Ratelimit-Reset
+	defaultRetryDelay = time.Second
+)
+
+var (
+	// ErrBadRequest is matched by errors of 400 responses
+	ErrBadRequest = errors.New("bad request")
+	// ErrUnauthorized is matched by errors of 401 responses, e.g. without app access token
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrNotFound is matched by errors of 404 responses
+	ErrNotFound = errors.New("not found")
+	// ErrRateLimited is matched by errors of 429 responses left after all retries
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// APIError is a non-200 response of Helix or OAuth API
+type APIError struct {
+	StatusCode int
+	// Err and Message are from the response body, if any
+	Err     string `json:"error"`
+	Message string `json:"message"`
+	// Reset is when rate limit is restored, if the response had Ratelimit-Reset
+	Reset time.Time
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("server responded with %d code", e.StatusCode)
+	if e.Err != "" {
+		msg += ". " + e.Err
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Is allows errors.Is(err, ErrNotFound) and others for API errors
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// Doer sends HTTP requests. *http.Client is a Doer
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client is a Helix API client. It's safe for concurrent use
+type Client struct {
+	// ClientID is Client-ID of the application registered in Twitch developer console
+	ClientID string
+	// Token returns access token sent as Bearer. It's asked for a new one once if Helix rejects the token.
+	// Nil means requests without Authorization
+	Token func(ctx context.Context, refresh bool) (string, error)
+	// HTTP sends requests. Nil means http.DefaultClient
+	HTTP Doer
+	// BaseURL and TokenURL replace the default endpoints if set
+	BaseURL  string
+	TokenURL string
+
+	mu sync.Mutex
+	// remaining and reset are the last known rate limit
+	remaining int
+	reset     time.Time
+
+	// now and sleep are variables for tests
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewClient returns a client with default endpoints
+func NewClient(clientID string) *Client {
+	return &Client{ClientID: clientID}
+}
+
+func (c *Client) doer() Doer {
+	if c.HTTP == nil {
+		return http.DefaultClient
+	}
+	return c.HTTP
+}
+
+func (c *Client) timeNow() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+func (c *Client) wait(ctx context.Context, d time.Duration) error {
+	if c.sleep != nil {
+		return c.sleep(ctx, d)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// waitRateLimit waits for rate limit reset if no requests are left
+func (c *Client) waitRateLimit(ctx context.Context) error {
+	c.mu.Lock()
+	d := time.Duration(0)
+	if c.remaining <= 0 && !c.reset.IsZero() {
+		d = c.reset.Sub(c.timeNow())
+	}
+	c.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	return c.wait(ctx, d)
+}
+
+// updateRateLimit remembers rate limit of the response and returns its reset time
+func (c *Client) updateRateLimit(h http.Header) time.Time {
+	remaining, err := strconv.Atoi(h.Get("Ratelimit-Remaining"))
+	if err != nil {
+		return time.Time{}
+	}
+	var reset time.Time
+	if sec, err := strconv.ParseInt(h.Get("Ratelimit-Reset"), 10, 64); err == nil {
+		reset = time.Unix(sec, 0)
+	}
+	c.mu.Lock()
+	c.remaining, c.reset = remaining, reset
+	c.mu.Unlock()
+	return reset
+}
+
+// responseError reads API error from the body of non-200 response
+func responseError(resp *http.Response) *APIError {
+	e := &APIError{}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, e); err != nil || (e.Err == "" && e.Message == "") {
+		e.Err, e.Message = "", strings.TrimSpace(string(body))
+	}
+	e.StatusCode = resp.StatusCode
+	return e
+}
+
+// get requests the endpoint and decodes the response into v. It waits for rate limit reset before
+// the request and retries it if rate limit is exceeded, and asks for a new token once on 401
+func (c *Client) get(ctx context.Context, path string, q url.Values, v interface{}) error {
+	base := c.BaseURL
+	if base == "" {
+		base = BaseURL
+	}
+	link := base + path
+	if len(q) > 0 {
+		link += "?" + q.Encode()
+	}
+	refreshed := false
+	for retries := 0; ; {
+		if err := c.waitRateLimit(ctx); err != nil {
+			return fmt.Errorf("get: %s", err.Error())
+		}
+		req, err := http.NewRequest("GET", link, nil)
+		if err != nil {
+			return fmt.Errorf("get: cannot create request. %s", err.Error())
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Client-ID", c.ClientID)
+		if c.Token != nil {
+			token, err := c.Token(ctx, refreshed)
+			if err != nil {
+				return fmt.Errorf("get: cannot get access token. %w", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := c.doer().Do(req)
+		if err != nil {
+			return fmt.Errorf("get: cannot retrieve data. %s", err.Error())
+		}
+		reset := c.updateRateLimit(resp.Header)
+		if resp.StatusCode == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(v)
+			resp.Body.Close()
+			if err != nil {
+				return fmt.Errorf("get: cannot decode data. %s", err.Error())
+			}
+			return nil
+		}
+		apiErr := responseError(resp)
+		resp.Body.Close()
+		apiErr.Reset = reset
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && c.Token != nil && !refreshed:
+			refreshed = true
+			continue
+		case resp.StatusCode == http.StatusTooManyRequests && retries < maxRetries:
+			retries++
+			d := defaultRetryDelay
+			if !reset.IsZero() {
+				d = reset.Sub(c.timeNow())
+			}
+			if err = c.wait(ctx, d); err != nil {
+				return fmt.Errorf("get: %w. %s", apiErr, err.Error())
+			}
+			continue
+		}
+		return fmt.Errorf("get: %w", apiErr)
+	}
+}
+
+// page is a response of an endpoint with cursor pagination
+type page struct {
+	Data       json.RawMessage `json:"data"`
+	Pagination struct {
+		Cursor string `json:"cursor"`
+	} `json:"pagination"`
+}
+
+// list requests pages of the endpoint starting from the after cursor until limit items are received
+// or there are no pages left. 0 limit means all pages. add decodes data of a page and returns the number of items in it.
+// The returned cursor continues the list
+func (c *Client) list(ctx context.Context, path string, q url.Values, after string, limit int, add func(data json.RawMessage) (int, error)) (string, error) {
+	// lookups by IDs are not paginated and don't accept first
+	byIDs := len(q["id"]) > 0
+	for got := 0; ; {
+		if !byIDs {
+			first := maxPageSize
+			if limit > 0 && limit-got < first {
+				first = limit - got
+			}
+			q.Set("first", strconv.Itoa(first))
+			q.Del("after")
+			if after != "" {
+				q.Set("after", after)
+			}
+		}
+		var p page
+		if err := c.get(ctx, path, q, &p); err != nil {
+			return "", err
+		}
+		n := 0
+		if len(p.Data) > 0 && string(p.Data) != "null" {
+			var err error
+			if n, err = add(p.Data); err != nil {
+				return "", fmt.Errorf("list: cannot decode data. %s", err.Error())
+			}
+		}
+		got += n
+		after = p.Pagination.Cursor
+		if byIDs || after == "" || n == 0 || (limit > 0 && got >= limit) {
+			return after, nil
+		}
+	}
+}
+
+// AppToken is an app access token of the client credentials flow
+type AppToken struct {
+	AccessToken string
+	ExpiresIn   time.Duration
+}
+
+// RequestAppToken requests app access token with the client secret of the application
+func (c *Client) RequestAppToken(ctx context.Context, clientSecret string) (*AppToken, error) {
+	link := c.TokenURL
+	if link == "" {
+		link = TokenURL
+	}
+	q := url.Values{}
+	q.Set("client_id", c.ClientID)
+	q.Set("client_secret", clientSecret)
+	q.Set("grant_type", "client_credentials")
+	req, err := http.NewRequest("POST", link, strings.NewReader(q.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("RequestAppToken: cannot create request. %s", err.Error())
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.doer().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("RequestAppToken: cannot get app access token. %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("RequestAppToken: %w", responseError(resp))
+	}
+	var data struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("RequestAppToken: cannot decode data. %s", err.Error())
+	}
+	if data.AccessToken == "" {
+		return nil, errors.New("RequestAppToken: no token in response")
+	}
+	return &AppToken{
+		AccessToken: data.AccessToken,
+		ExpiresIn:   time.Duration(data.ExpiresIn) * time.Second,
+	}, nil
+}
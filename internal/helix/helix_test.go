@@ -0,0 +1,208 @@
+package helix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client of the fake server which doesn't sleep but records waits
+func newTestClient(h http.HandlerFunc) (*Client, *[]time.Duration, func()) {
+	srv := httptest.NewServer(h)
+	now := time.Unix(1600000000, 0)
+	waits := []time.Duration{}
+	c := NewClient("client")
+	c.BaseURL, c.TokenURL = srv.URL, srv.URL+"/oauth2/token"
+	c.now = func() time.Time { return now }
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return nil
+	}
+	return c, &waits, srv.Close
+}
+
+func TestAPIError(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+		is     error
+		want   string
+	}{
+		{status: 400, body: `{"error":"Bad Request","status":400,"message":"Malformed query params."}`, is: ErrBadRequest,
+			want: "get: server responded with 400 code. Bad Request: Malformed query params."},
+		{status: 401, body: `{"error":"Unauthorized","status":401,"message":"OAuth token is missing"}`, is: ErrUnauthorized,
+			want: "get: server responded with 401 code. Unauthorized: OAuth token is missing"},
+		{status: 404, body: "page not found\n", is: ErrNotFound, want: "get: server responded with 404 code: page not found"},
+		{status: 500, body: "", want: "get: server responded with 500 code"},
+	}
+	for _, c := range cases {
+		cl, _, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.status)
+			fmt.Fprint(w, c.body)
+		})
+		err := cl.get(context.Background(), "/videos", nil, &struct{}{})
+		done()
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != c.status || err.Error() != c.want {
+			t.Errorf("get: test failed. got: %v. want: %s", err, c.want)
+		}
+		if c.is != nil && !errors.Is(err, c.is) {
+			t.Errorf("get: test failed. %v is not %v", err, c.is)
+		}
+		if errors.Is(err, ErrRateLimited) {
+			t.Errorf("get: test failed. %v is %v", err, ErrRateLimited)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	requests := 0
+	c, waits, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Ratelimit-Reset", "1600000010")
+		switch requests {
+		case 1:
+			w.Header().Set("Ratelimit-Remaining", "0")
+			fmt.Fprint(w, `{}`)
+		case 2:
+			w.Header().Set("Ratelimit-Remaining", "0")
+			w.Header().Set("Ratelimit-Reset", "1600000015")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Header().Set("Ratelimit-Remaining", "799")
+			fmt.Fprint(w, `{}`)
+		}
+	})
+	defer done()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := c.get(ctx, "/games", nil, &struct{}{}); err != nil {
+			t.Fatalf("get: test failed. got an error: %s", err.Error())
+		}
+	}
+	// waits for reset after the first response, retries on 429 after its reset and doesn't wait with requests left
+	want := []time.Duration{10 * time.Second, 5 * time.Second}
+	if fmt.Sprint(*waits) != fmt.Sprint(want) || requests != 4 {
+		t.Errorf("get: test failed. got waits: %v, requests: %d. want: %v, 4", *waits, requests, want)
+	}
+}
+
+func TestRateLimitExceeded(t *testing.T) {
+	requests := 0
+	c, waits, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	defer done()
+	err := c.get(context.Background(), "/games", nil, &struct{}{})
+	if !errors.Is(err, ErrRateLimited) || requests != maxRetries+1 || len(*waits) != maxRetries {
+		t.Errorf("get: test failed. got: %v after %d requests and %d waits", err, requests, len(*waits))
+	}
+
+	c.sleep = func(ctx context.Context, d time.Duration) error { return context.Canceled }
+	if err = c.get(context.Background(), "/games", nil, &struct{}{}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("get: test failed with cancelled wait. got: %v", err)
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	valid := "new"
+	c, _, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Client-ID") != "client" {
+			t.Errorf("get: test failed. got Client-ID: %s", r.Header.Get("Client-ID"))
+		}
+		if r.Header.Get("Authorization") != "Bearer "+valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	})
+	defer done()
+	refreshes := 0
+	c.Token = func(ctx context.Context, refresh bool) (string, error) {
+		if refresh {
+			refreshes++
+			return "new", nil
+		}
+		return "old", nil
+	}
+	if err := c.get(context.Background(), "/users", nil, &struct{}{}); err != nil || refreshes != 1 {
+		t.Errorf("get: test failed. got: %v after %d refreshes", err, refreshes)
+	}
+	valid = "other"
+	if err := c.get(context.Background(), "/users", nil, &struct{}{}); !errors.Is(err, ErrUnauthorized) || refreshes != 2 {
+		t.Errorf("get: test failed. got: %v after %d refreshes. want: %v", err, refreshes, ErrUnauthorized)
+	}
+}
+
+func TestList(t *testing.T) {
+	c, _, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		first, _ := strconv.Atoi(r.FormValue("first"))
+		start, _ := strconv.Atoi(r.FormValue("after"))
+		if r.FormValue("id") != "" {
+			if r.FormValue("first") != "" {
+				t.Errorf("list: test failed. first is sent with id")
+			}
+			first = 1
+		}
+		fmt.Fprint(w, `{"data":[`)
+		for i := start; i < start+first && i < 250; i++ {
+			if i > start {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `{"id":"%d"}`, i)
+		}
+		cursor := ""
+		if start+first < 250 {
+			cursor = strconv.Itoa(start + first)
+		}
+		fmt.Fprintf(w, `],"pagination":{"cursor":"%s"}}`, cursor)
+	})
+	defer done()
+	ctx := context.Background()
+	cases := []struct {
+		query      VideosQuery
+		n          int
+		first      string
+		wantCursor string
+	}{
+		{query: VideosQuery{UserID: "1"}, n: 250, first: "0", wantCursor: ""},
+		{query: VideosQuery{UserID: "1", Limit: 150}, n: 150, first: "0", wantCursor: "150"},
+		{query: VideosQuery{UserID: "1", Limit: 5, After: "245"}, n: 5, first: "245", wantCursor: ""},
+		{query: VideosQuery{IDs: []string{"7"}}, n: 1, first: "0", wantCursor: "1"},
+	}
+	for _, cs := range cases {
+		videos, cursor, err := c.GetVideos(ctx, cs.query)
+		if err != nil || len(videos) != cs.n || cursor != cs.wantCursor || videos[0].ID != cs.first {
+			t.Errorf("GetVideos: test failed for %+v. got %d videos, cursor %q, %v. want: %d, %q", cs.query, len(videos), cursor, err, cs.n, cs.wantCursor)
+		}
+	}
+}
+
+func TestRequestAppToken(t *testing.T) {
+	c, _, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth2/token" || r.Method != "POST" {
+			t.Errorf("RequestAppToken: test failed. got request: %s %s", r.Method, r.URL.Path)
+		}
+		if r.FormValue("client_id") != "client" || r.FormValue("grant_type") != "client_credentials" || r.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"status":403,"message":"invalid client secret"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"abc","expires_in":3600,"token_type":"bearer"}`)
+	})
+	defer done()
+	token, err := c.RequestAppToken(context.Background(), "secret")
+	if err != nil || token.AccessToken != "abc" || token.ExpiresIn != time.Hour {
+		t.Errorf("RequestAppToken: test failed. got: %+v, %v", token, err)
+	}
+	if _, err = c.RequestAppToken(context.Background(), "wrong"); err == nil || err.Error() != "RequestAppToken: server responded with 403 code: invalid client secret" {
+		t.Errorf("RequestAppToken: test failed with wrong secret. got: %v", err)
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"flag"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
 	"regexp"
 	"runtime/pprof"
@@ -16,7 +18,7 @@ const (
 	regCheckCorrectArg = "(\\s|https:\\/\\/www\\.|^|www\\.)twitch\\.tv\\/videos\\/(\\d+){9}$"
 )
 
-var debug, timeF bool
+var debug, timeF, chat, muxSubs, metadata bool
 
 // TODO
 // Write tests for API connections, downloading TS, downloading VOD
@@ -26,18 +28,110 @@ var debug, timeF bool
 func main() {
 	defaultVOD := "-1"
 	defaultSE := "-1"
-	defaultQuality := "chunked"
+	defaultQuality := "source,best"
 	start := flag.String("start", defaultSE, "Start VOD with a certain time, e.g. 0h20m19s")
 	end := flag.String("end", defaultSE, "End VOD with a certain time, e.g. 3h04m0s")
-	quality := flag.String("quality", defaultQuality, "Defines quality of VOD. 'Chunked' is the source quality")
-	flag.BoolVar(&debug, "debug", false, "If set — output debug info")
+	quality := flag.String("quality", defaultQuality, "Quality of VOD: best, worst, source, audio_only, 720p60, 720p, >=720p or <=480p30. Comma separated rules are tried in order, e.g. 1080p60,720p60,best. Several qualities are downloaded together if all comma separated names are available, e.g. chunked,480p30, or if they are separated by +, e.g. source,best+<=480p30")
+	flag.BoolVar(&debug, "debug", false, "If set — output debug info. Same as -log-level debug")
+	logLevel := flag.String("log-level", "warn", "Minimum level of diagnostic logs: 'debug', 'info', 'warn' or 'error'")
+	logFormat := flag.String("log-format", downloader.LogFormatText, "Format of diagnostic logs: 'text' or 'json'")
+	logFile := flag.String("log-file", "", "Append diagnostic logs to this file instead of stderr")
 	flag.BoolVar(&timeF, "time", false, "If set — shows elapsed time for each period of work")
+	flag.BoolVar(&chat, "chat", false, "If set — download chat replay of the VOD in JSON lines alongside the video")
+	subs := flag.String("subs", "", "Render chat replay to subtitles: 'ass' or 'srt'. Implies -chat")
+	flag.BoolVar(&muxSubs, "mux-subs", false, "If set — mux rendered chat replay into the output file as a subtitle stream")
+	container := flag.String("container", "mp4", "Format of the output file: 'mp4' or 'mkv'")
+	audioOnly := flag.Bool("audio-only", false, "If set — download only audio into m4a file. Audio is extracted from the lowest quality if there is no audio only one")
+	transcode := flag.String("transcode", "", "Transcode the output file with a CPU encoding profile: "+strings.Join(downloader.TranscodeProfiles(), ", ")+". By default streams are copied without re-encoding")
+	flag.BoolVar(&metadata, "metadata", true, "If set — write VOD info and thumbnail as cover art into the output file")
+	oauth := flag.String("oauth", "", "User OAuth token to download subscriber-only VODs. Prefer TTVLDR_OAUTH environment variable or config file to keep it out of shell history")
+	clientID := flag.String("client-id", downloader.HelixClientID, "Client ID of your application from Twitch developer console, used for Twitch API with -client-secret")
+	clientSecret := flag.String("client-secret", "", "Client secret of your application for Twitch API app access token. Prefer TTVLDR_CLIENT_SECRET environment variable or config file")
+	tokenProviders := flag.String("token-providers", "gql,legacy", "Comma separated access token providers tried in the given order: 'gql', 'legacy'")
+	hls := flag.Bool("hls", false, "If set — treat the link as any HLS master or media playlist, not a Twitch one")
+	variant := flag.String("variant", "best", "Variant of HLS master playlist in -hls mode: 'best', 'worst', resolution like '1280x720' or maximum bandwidth in bits per second like '3M', where k is 1000 and M is 1000000 as in playlist BANDWIDTH")
+	flag.Var(headerFlag{}, "header", "Extra HTTP header for playlist, key and segment requests, e.g. 'Referer: https://example.com'. May be repeated")
+	cookie := flag.String("cookie", "", "Cookies for playlist, key and segment requests, e.g. 'session=abc; lang=en'")
+	httpOpts := downloader.HTTP
+	flag.DurationVar(&httpOpts.ConnectTimeout, "connect-timeout", httpOpts.ConnectTimeout, "Timeout of establishing connection, e.g. 10s. 0 means no timeout")
+	flag.DurationVar(&httpOpts.TLSHandshakeTimeout, "tls-timeout", httpOpts.TLSHandshakeTimeout, "Timeout of TLS handshake. 0 means no timeout")
+	flag.DurationVar(&httpOpts.ResponseHeaderTimeout, "header-timeout", httpOpts.ResponseHeaderTimeout, "Timeout of waiting for response headers. 0 means no timeout")
+	flag.DurationVar(&httpOpts.IdleConnTimeout, "idle-timeout", httpOpts.IdleConnTimeout, "Close keep-alive connections idle for this long. 0 means never")
+	flag.DurationVar(&httpOpts.RequestTimeout, "request-timeout", httpOpts.RequestTimeout, "Deadline of API and playlist requests. 0 means no deadline")
+	flag.DurationVar(&httpOpts.SegmentTimeout, "segment-timeout", httpOpts.SegmentTimeout, "Deadline of downloading of a single segment, retried after it. 0 means no deadline")
+	flag.IntVar(&httpOpts.MaxConnsPerHost, "max-conns-per-host", httpOpts.MaxConnsPerHost, "Maximum connections per host. 0 means no limit")
+	flag.IntVar(&httpOpts.MaxIdleConnsPerHost, "max-idle-conns-per-host", httpOpts.MaxIdleConnsPerHost, "Maximum keep-alive connections per host")
+	flag.StringVar(&httpOpts.Proxy, "proxy", "", "Proxy for every request: http://, https:// or socks5:// URL. HTTP_PROXY and HTTPS_PROXY are used if not set")
+	flag.StringVar(&httpOpts.UserAgent, "user-agent", "", "User-Agent for every request")
+	hookOpts := downloader.Hooks
+	flag.StringVar(&hookOpts.Command, "hook-command", "", "Command run by the shell on job events with TTVLDR_HOOK_EVENT, TTVLDR_HOOK_VOD_ID, TTVLDR_HOOK_OUTPUT, TTVLDR_HOOK_SIZE, TTVLDR_HOOK_DURATION, TTVLDR_HOOK_QUALITY and other environment variables")
+	flag.StringVar(&hookOpts.URL, "hook-url", "", "URL which gets job events as JSON with POST request")
+	hookEvents := flag.String("hook-events", "started,finished,failed", "Comma separated job events hooks run on: 'started', 'finished', 'failed'")
+	flag.DurationVar(&hookOpts.Timeout, "hook-timeout", hookOpts.Timeout, "Timeout of a single run of the hook command or webhook request. 0 means no timeout")
+	flag.IntVar(&hookOpts.Retries, "hook-retries", hookOpts.Retries, "How many times a failed hook is run again")
+	limitRate := flag.String("limit-rate", "0", "Limit download speed of all workers in bytes per second, e.g. 500k or 5M, where k is 1024 and M is 1024*1024 bytes. 0 means no limit")
+	limitSchedule := flag.String("limit-schedule", "", "Time of day speed limits, e.g. '09:00-18:00=1M,22:00-06:00=0'. -limit-rate is used outside of intervals")
+	outputName := flag.String("output-name", "", "Go template of the output file name of Twitch VODs without extension, e.g. '{{.Streamer.Login}}_{{.CreatedAt.Format \"2006-01-02\"}}_{{.ID}}'. Fields are the same as in -info -format plus Quality. VOD ID by default")
+	tmpDir := flag.String("tmpdir", ".", "Directory for temporary files, e.g. on a fast scratch disk")
+	outDir := flag.String("outdir", ".", "Directory for the output file, chat replay and subtitles")
+	diskCheck := flag.Bool("disk-check", true, "If set — refuse to download without enough free disk space for the estimated size, otherwise only warn")
 	info := flag.Bool("info", false, "Shows full info about VOD and quality options")
+	jsonInfo := flag.Bool("json", false, "If set with -info — print VOD info and renditions as JSON")
+	format := flag.String("format", "", "Go template for -info output, e.g. '{{.Title}} | {{duration .DurationSeconds}} | {{.CreatedAt.Format \"2006-01-02\"}}'")
 	cpuprofile := flag.String("cpuprofile", "", "Dump CPU usage profile to a certain file to further <go tool pprof>")
 	memprofile := flag.String("memprofile", "", "Dump RAM usage profile to a certain file to further <go tool pprof>")
+	conf, err := readConfig(configPath())
+	if err == nil {
+		err = applyDefaults(flag.CommandLine, conf)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	flag.Parse()
-	downloader.Debug = debug
+	cli := commandLineFlags(flag.CommandLine, os.Args[1:])
+	if err = configureLogging(*logLevel, *logFormat, *logFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	downloader.TimeF = timeF
+	downloader.Chat = chat
+	downloader.Subtitles = *subs
+	downloader.MuxSubtitles = muxSubs
+	downloader.Container = *container
+	downloader.AudioOnly = *audioOnly
+	downloader.Transcode = *transcode
+	downloader.Metadata = metadata
+	downloader.OAuthToken = strings.TrimPrefix(*oauth, "oauth:")
+	downloader.HelixClientID = *clientID
+	downloader.HelixClientSecret = *clientSecret
+	tp, err := downloader.TokenProvidersByName(strings.Split(*tokenProviders, ","))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	downloader.TokenProviders = tp
+	downloader.Cookies = *cookie
+	downloader.DiskSpaceCheck = *diskCheck
+	downloader.TempDir = *tmpDir
+	downloader.OutputDir = *outDir
+	downloader.OutputName = *outputName
+	if err = downloader.ConfigureHTTP(httpOpts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	hookOpts.Events = strings.Split(*hookEvents, ",")
+	if err = downloader.ConfigureHooks(hookOpts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err = setRateLimit(*limitRate, *limitSchedule); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	watchReload(func() {
+		reloadRateLimit(flag.CommandLine, cli)
+	})
 
 	args := flag.Args()
 	if len(args) != 1 {
@@ -45,54 +139,59 @@ func main() {
 		os.Exit(1)
 	}
 
-	vodID := getVODFromStdin(args[0])
-	if vodID == defaultVOD {
+	playlist, vodID := "", getVODFromStdin(args[0])
+	if isPlaylistURL(args[0]) || (*hls && isHTTPURL(args[0])) {
+		playlist = args[0]
+	}
+	if (vodID == defaultVOD || *hls) && (playlist == "" || *info) {
 		usage()
 		os.Exit(1)
 	}
 
+	if *info && *format != "" {
+		fmt.Print(downloader.GetVODInfoFormat(vodID, *format))
+		os.Exit(0)
+	}
+	if *info && *jsonInfo {
+		fmt.Print(downloader.GetVODInfoJSON(vodID))
+		os.Exit(0)
+	}
 	if *info {
 		fmt.Print(downloader.GetVODInfo(vodID))
 		os.Exit(0)
 	}
 
 	startT := time.Now()
-	if defaultSE == *start || defaultSE == *end {
-		downloader.DownloadVOD(vodID, "0", "-1", *quality)
-		if *cpuprofile != "" {
-			f, err := os.Create(*cpuprofile)
-			if err != nil {
-				panic(err)
-			}
-			pprof.StartCPUProfile(f)
-			defer pprof.StopCPUProfile()
-		}
-		if *memprofile != "" {
-			f, err := os.Create(*memprofile)
-			if err != nil {
-				panic(err)
-			}
-			pprof.WriteHeapProfile(f)
-			f.Close()
-		}
+	s, e := *start, *end
+	if defaultSE == s || defaultSE == e {
+		s, e = "0", "-1"
+	}
+	if *hls {
+		err = downloader.DownloadHLS(playlist, s, e, *variant)
+	} else if playlist != "" {
+		err = downloader.DownloadPlaylist(playlist, s, e, *quality)
 	} else {
-		downloader.DownloadVOD(vodID, *start, *end, *quality)
-		if *cpuprofile != "" {
-			f, err := os.Create(*cpuprofile)
-			if err != nil {
-				panic(err)
-			}
-			pprof.StartCPUProfile(f)
-			defer pprof.StopCPUProfile()
+		err = downloader.DownloadVOD(vodID, s, e, *quality)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *cpuprofile != "" {
+		f, err := os.Create(*cpuprofile)
+		if err != nil {
+			panic(err)
 		}
-		if *memprofile != "" {
-			f, err := os.Create(*memprofile)
-			if err != nil {
-				panic(err)
-			}
-			pprof.WriteHeapProfile(f)
-			f.Close()
+		pprof.StartCPUProfile(f)
+		defer pprof.StopCPUProfile()
+	}
+	if *memprofile != "" {
+		f, err := os.Create(*memprofile)
+		if err != nil {
+			panic(err)
 		}
+		pprof.WriteHeapProfile(f)
+		f.Close()
 	}
 	endT := time.Since(startT)
 	if timeF {
@@ -100,8 +199,82 @@ func main() {
 	}
 }
 
+func configureLogging(level, format, file string) error {
+	opts := downloader.LogOptions{Output: os.Stderr, Format: format}
+	if err := opts.Level.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unknown log level %s. Use debug, info, warn or error", level)
+	}
+	if debug {
+		opts.Level = slog.LevelDebug
+	}
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		opts.Output = f
+	}
+	return downloader.ConfigureLogging(opts)
+}
+
+func setRateLimit(limitRate, limitSchedule string) error {
+	rate, err := downloader.ParseRate(limitRate)
+	if err != nil {
+		return err
+	}
+	if err = downloader.SetRateSchedule(limitSchedule); err != nil {
+		return err
+	}
+	downloader.SetRateLimit(rate)
+	return nil
+}
+
+// reloadRateLimit applies limit-rate and limit-schedule from the config file. They override options
+// given on start, the ones missing in the config file get their start values back
+func reloadRateLimit(fs *flag.FlagSet, cli map[string]bool) {
+	conf, err := readConfig(configPath())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	limitRate := reloadValue(fs, "limit-rate", cli, conf)
+	limitSchedule := reloadValue(fs, "limit-schedule", cli, conf)
+	if err = setRateLimit(limitRate, limitSchedule); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Printf("\nSpeed limit was reloaded: %s, schedule: '%s'\n", limitRate, limitSchedule)
+}
+
 func usage() {
-	fmt.Println("Wrong input. Usage: ttvldr <flags> https://www.twitch.tv/videos/123456789. Check -help option for more information")
+	fmt.Println("Wrong input. Usage: ttvldr <flags> https://www.twitch.tv/videos/123456789 or ttvldr <flags> https://example.com/playlist.m3u8. Check -help option for more information")
+}
+
+// isPlaylistURL checks if input is a link to m3u8 playlist
+func isPlaylistURL(input string) bool {
+	u, err := url.Parse(input)
+	return err == nil && isHTTPURL(input) && strings.HasSuffix(strings.ToLower(u.Path), ".m3u8")
+}
+
+func isHTTPURL(input string) bool {
+	u, err := url.Parse(input)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// headerFlag adds 'Name: value' headers to downloader.Headers
+type headerFlag struct{}
+
+func (headerFlag) String() string {
+	return ""
+}
+
+func (headerFlag) Set(h string) error {
+	i := strings.Index(h, ":")
+	if i <= 0 {
+		return fmt.Errorf("header %q is not in 'Name: value' format", h)
+	}
+	downloader.Headers.Add(strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:]))
+	return nil
 }
 
 func getVODFromStdin(input string) string {
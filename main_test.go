@@ -1,7 +1,10 @@
 package main
 
 import (
+	"net/http"
 	"testing"
+
+	"github.com/zerospiel/ttvldr/downloader"
 )
 
 func TestGetVODFromStdin(t *testing.T) {
@@ -33,3 +36,42 @@ func TestGetVODFromStdin(t *testing.T) {
 		}
 	}
 }
+
+func TestIsPlaylistURL(t *testing.T) {
+	cases := []struct {
+		input string
+		want  bool
+	}{
+		{input: "https://d2nvs31859zcd8.cloudfront.net/vod/chunked/index-dvr.m3u8", want: true},
+		{input: "http://example.com/live/Master.M3U8?token=abc", want: true},
+		{input: "https://www.twitch.tv/videos/123456789", want: false},
+		{input: "example.com/index.m3u8", want: false},
+		{input: "ftp://example.com/index.m3u8", want: false},
+		{input: "", want: false},
+	}
+	for _, c := range cases {
+		if got := isPlaylistURL(c.input); got != c.want {
+			t.Errorf("isPlaylistURL: failed test. input: %s. got: %v; want: %v", c.input, got, c.want)
+		}
+	}
+}
+
+func TestHeaderFlag(t *testing.T) {
+	defer func() { downloader.Headers = http.Header{} }()
+	var h headerFlag
+	if err := h.Set("Referer: https://example.com/a:b"); err != nil {
+		t.Errorf("headerFlag: failed test. got an error: %s", err.Error())
+	}
+	if err := h.Set("X-Foo:bar"); err != nil {
+		t.Errorf("headerFlag: failed test. got an error: %s", err.Error())
+	}
+	if got := downloader.Headers.Get("Referer"); got != "https://example.com/a:b" {
+		t.Errorf("headerFlag: failed test. got: %s; want: %s", got, "https://example.com/a:b")
+	}
+	if got := downloader.Headers.Get("X-Foo"); got != "bar" {
+		t.Errorf("headerFlag: failed test. got: %s; want: %s", got, "bar")
+	}
+	if err := h.Set("no colon"); err == nil {
+		t.Errorf("headerFlag: failed test. want an error for malformed header")
+	}
+}
@@ -0,0 +1,4 @@
+package main
+
+// watchReload does nothing since there is no SIGHUP on Windows
+func watchReload(reload func()) {}